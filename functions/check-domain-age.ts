@@ -1,19 +1,46 @@
 import type { Handler } from '@netlify/functions';
-
-const RDAP_TIMEOUT_MS = 5_000;
+import { readCappedJson } from './lib/body';
+import { envDurationMs, logConfig } from './lib/env';
+import { withEnvelope } from './lib/envelope';
+import { withRequestLog } from './lib/request-log';
+import { negotiateLocale, reasonText, type ReasonCode } from './lib/reasons';
+import { endpointLimiter, withRateLimit } from './lib/rate-limit';
+import { withSecurityHeaders } from './lib/security-headers';
+import { MemoryCache, type Cache } from './lib/ttl-cache';
+import { userAgent } from './lib/user-agent';
+
+const RDAP_TIMEOUT_MS = envDurationMs('INTEL_TIMEOUT', 5_000);
 const CACHE_TTL_MS = 12 * 60 * 60 * 1000; // 12h — registration dates don't move
-const CACHE_MAX_ENTRIES = 500;
+const NEW_DOMAIN_DAYS = 30;
+
+// Repeat lookups for popular domains skip RDAP entirely
+const cache: Cache<DomainAgeResult> = new MemoryCache();
 
-// Warm-instance cache: Netlify reuses function containers between
-// invocations, so repeat lookups for popular domains skip RDAP entirely.
-const cache = new Map<string, { result: DomainAgeResult; expires: number }>();
+const rateLimiter = endpointLimiter('check-domain-age');
+logConfig('check-domain-age', { intel_timeout_ms: RDAP_TIMEOUT_MS, rate_limit: rateLimiter.limit });
 
 export interface DomainAgeResult {
   age_days: number | null;
+  /** ISO-8601 registration date from RDAP, when known. */
+  registered_at: string | null;
+  /** True when the domain was registered less than 30 days ago. */
+  suspicious_new: boolean;
   risk_points: number;
+  /** Stable identifier for `message`, for clients that localize. */
+  code: ReasonCode;
   message: string;
 }
 
+function unknownAge(code: ReasonCode): DomainAgeResult {
+  return { age_days: null, registered_at: null, suspicious_new: false, risk_points: 0, code, message: reasonText(code) };
+}
+
+/** Re-render a result's message in another locale. */
+function localize(result: DomainAgeResult, locale: ReturnType<typeof negotiateLocale>): DomainAgeResult {
+  const days = result.age_days ?? 0;
+  return { ...result, message: reasonText(result.code, locale, { days, years: Math.floor(days / 365) }) };
+}
+
 /**
  * Reduce a hostname to its registrable domain for RDAP lookup.
  * Rudimentary public-suffix approximation: keeps the last two labels, or the
@@ -33,49 +60,64 @@ export function registrableDomain(host: string): string {
   return parts.slice(-2).join('.');
 }
 
-export function scoreAge(ageInDays: number): DomainAgeResult {
-  if (ageInDays < 30) {
+export function scoreAge(ageInDays: number, registeredAt: string | null = null): DomainAgeResult {
+  const base = {
+    age_days: ageInDays,
+    registered_at: registeredAt,
+    suspicious_new: ageInDays < NEW_DOMAIN_DAYS
+  };
+  const vars = { days: ageInDays, years: Math.floor(ageInDays / 365) };
+  if (ageInDays < NEW_DOMAIN_DAYS) {
     return {
-      age_days: ageInDays,
+      ...base,
       risk_points: 20,
-      message: `Very new domain (${ageInDays} days old)`
+      code: 'DOMAIN_VERY_NEW',
+      message: reasonText('DOMAIN_VERY_NEW', 'en', vars)
     };
   }
   if (ageInDays < 90) {
     return {
-      age_days: ageInDays,
+      ...base,
       risk_points: 10,
-      message: `New domain (${ageInDays} days old)`
+      code: 'DOMAIN_NEW',
+      message: reasonText('DOMAIN_NEW', 'en', vars)
     };
   }
   if (ageInDays >= 5 * 365) {
-    const years = Math.floor(ageInDays / 365);
     return {
-      age_days: ageInDays,
+      ...base,
       risk_points: -10,
-      message: `Established domain (${years} years old)`
+      code: 'DOMAIN_ESTABLISHED',
+      message: reasonText('DOMAIN_ESTABLISHED', 'en', vars)
     };
   }
   return {
-    age_days: ageInDays,
+    ...base,
     risk_points: 0,
-    message: `Domain ${ageInDays} days old`
+    code: 'DOMAIN_AGE',
+    message: reasonText('DOMAIN_AGE', 'en', vars)
   };
 }
 
+/** Thrown when RDAP has no record for the domain (HTTP 404). */
+class RdapNotFoundError extends Error {}
+
 async function fetchRdapCreationDate(domain: string): Promise<string | null> {
   // rdap.org redirects to the authoritative RDAP server for the TLD
   const rdapUrl = `https://rdap.org/domain/${encodeURIComponent(domain)}`;
   const response = await fetch(rdapUrl, {
-    headers: { Accept: 'application/rdap+json' },
+    headers: { Accept: 'application/rdap+json', 'User-Agent': userAgent() },
     signal: AbortSignal.timeout(RDAP_TIMEOUT_MS)
   });
 
+  if (response.status === 404) {
+    throw new RdapNotFoundError(`No RDAP record for ${domain}`);
+  }
   if (!response.ok) {
     throw new Error(`RDAP lookup failed with status ${response.status}`);
   }
 
-  const data = await response.json();
+  const data = await readCappedJson<{ events?: unknown }>(response);
 
   // RDAP events array typically includes a registration/creation entry with eventDate
   const events: Array<{ eventAction?: unknown; eventDate?: unknown }> =
@@ -97,50 +139,46 @@ async function fetchRdapCreationDate(domain: string): Promise<string | null> {
 export async function lookupDomainAge(host: string): Promise<DomainAgeResult> {
   const domain = registrableDomain(host);
 
-  const cached = cache.get(domain);
-  if (cached && cached.expires > Date.now()) {
-    return cached.result;
+  const cached = await cache.get(domain);
+  if (cached) {
+    return cached;
   }
 
   let createdDate: string | null = null;
   try {
     createdDate = await fetchRdapCreationDate(domain);
-  } catch {
-    return {
-      age_days: null,
-      risk_points: 0,
-      message: 'Domain age check failed'
-    };
+  } catch (error) {
+    // A 404 (unknown domain or TLD without RDAP) and a timeout are both
+    // "unknown", but the message tells them apart for the UI.
+    return unknownAge(error instanceof RdapNotFoundError ? 'DOMAIN_NOT_FOUND' : 'DOMAIN_AGE_FAILED');
   }
 
   if (!createdDate || Number.isNaN(new Date(createdDate).getTime())) {
-    return {
-      age_days: null,
-      risk_points: 0,
-      message: 'Domain age could not be determined'
-    };
+    return unknownAge('DOMAIN_AGE_UNKNOWN');
   }
 
+  const registered = new Date(createdDate);
   const ageInDays = Math.max(
     0,
-    Math.floor((Date.now() - new Date(createdDate).getTime()) / (1000 * 60 * 60 * 24))
+    Math.floor((Date.now() - registered.getTime()) / (1000 * 60 * 60 * 24))
   );
 
-  const result = scoreAge(ageInDays);
+  const result = scoreAge(ageInDays, registered.toISOString());
 
-  if (cache.size >= CACHE_MAX_ENTRIES) {
-    cache.clear();
-  }
-  cache.set(domain, { result, expires: Date.now() + CACHE_TTL_MS });
+  await cache.set(domain, result, CACHE_TTL_MS);
 
   return result;
 }
 
-export const handler: Handler = async (event) => {
+export const handler: Handler = withRequestLog('check-domain-age', withSecurityHeaders(withEnvelope(withRateLimit(rateLimiter, async (event) => {
   if (event.httpMethod !== 'POST') {
     return { statusCode: 405, body: 'Method Not Allowed' };
   }
 
+  // Messages follow Accept-Language; `code` is the same in every locale
+  const locale = negotiateLocale(event.headers['accept-language']);
+  const headers = { 'content-type': 'application/json', 'content-language': locale, vary: 'Accept-Language' };
+
   try {
     const { domain } = JSON.parse(event.body || '{}');
 
@@ -152,18 +190,15 @@ export const handler: Handler = async (event) => {
 
     return {
       statusCode: 200,
-      headers: { 'content-type': 'application/json' } as Record<string, string>,
-      body: JSON.stringify(result)
+      headers,
+      body: JSON.stringify(localize(result, locale))
     };
   } catch (error) {
     console.error('Domain age check failed:', error);
     return {
       statusCode: 200,
-      body: JSON.stringify({
-        age_days: null,
-        risk_points: 0,
-        message: 'Domain age check failed'
-      })
+      headers,
+      body: JSON.stringify(localize(unknownAge('DOMAIN_AGE_FAILED'), locale))
     };
   }
-};
+}))));
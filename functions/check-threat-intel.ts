@@ -1,8 +1,48 @@
 import { createHash } from 'crypto';
 import type { Handler } from '@netlify/functions';
+import { abuseChHeaders } from './lib/abuse-ch';
+import { readCappedJson } from './lib/body';
+import { BREAKER_COOLDOWN_MS, BREAKER_THRESHOLD, CircuitBreaker } from './lib/circuit-breaker';
+import { listVerdict } from './lib/domain-lists';
+import { runFeeds, ThrottledError, type Feed, type FeedFinding } from './lib/feeds';
+import { negotiateLocale, reasonText, type ReasonCode } from './lib/reasons';
+import { KEEP_URL_FRAGMENTS, lookupUrl } from './lib/sanitize-url';
+import { envDurationMs, logConfig } from './lib/env';
+import { withEnvelope } from './lib/envelope';
+import { withRequestLog } from './lib/request-log';
+import { endpointLimiter, withRateLimit } from './lib/rate-limit';
+import { withSecurityHeaders } from './lib/security-headers';
+import { userAgent } from './lib/user-agent';
+
+// Default per-feed budget; the feeds run concurrently, so the largest one is
+// also the worst case.
+const INTEL_TIMEOUT_MS = envDurationMs('INTEL_TIMEOUT', 6_000);
+// Each feed may get its own budget, e.g. a shorter one for a feed that is
+// usually fast so it never waits out a slow one's worst case.
+const GSB_TIMEOUT_MS = envDurationMs('GSB_TIMEOUT', INTEL_TIMEOUT_MS);
+const ABUSEIPDB_TIMEOUT_MS = envDurationMs('ABUSEIPDB_TIMEOUT', INTEL_TIMEOUT_MS);
+const VT_TIMEOUT_MS = envDurationMs('VT_TIMEOUT', INTEL_TIMEOUT_MS);
+const THREATFOX_TIMEOUT_MS = envDurationMs('THREATFOX_TIMEOUT', INTEL_TIMEOUT_MS);
+const rateLimiter = endpointLimiter('check-threat-intel');
+logConfig('check-threat-intel', {
+  gsb_timeout_ms: GSB_TIMEOUT_MS,
+  abuseipdb_timeout_ms: ABUSEIPDB_TIMEOUT_MS,
+  vt_timeout_ms: VT_TIMEOUT_MS,
+  threatfox_timeout_ms: THREATFOX_TIMEOUT_MS,
+  keep_url_fragments: KEEP_URL_FRAGMENTS,
+  breaker_threshold: BREAKER_THRESHOLD,
+  breaker_cooldown_ms: BREAKER_COOLDOWN_MS,
+  rate_limit: rateLimiter.limit
+});
+
+// V5 response: fullHashes[].{ fullHash, fullHashDetails[].{ threatType } }
+interface GsbFullHash {
+  fullHash: string;
+  fullHashDetails: Array<{ threatType: string }>;
+}
 
 // Helper function for Google Safe Browsing API (V5)
-async function queryGoogleSafeBrowsing(targetUrl: string): Promise<Array<{ threatType: string }>> {
+async function queryGoogleSafeBrowsing(targetUrl: string, signal: AbortSignal): Promise<Array<{ threatType: string }>> {
   if (!process.env.GSB_API_KEY) {
     // Fallback to pattern analysis when no API key is available
     const suspiciousPatterns = [
@@ -29,26 +69,140 @@ async function queryGoogleSafeBrowsing(targetUrl: string): Promise<Array<{ threa
   endpoint.searchParams.append('hashPrefixes', hashPrefix);
 
   const response = await fetch(endpoint.toString(), {
-    headers: { 'User-Agent': 'qrcheck/1.0.0' },
-    signal: AbortSignal.timeout(6_000)
+    headers: { 'User-Agent': userAgent() },
+    signal
   });
   if (!response.ok) {
     throw new Error(`GSB request failed: ${response.status}`);
   }
-  const payload = await response.json();
+  const payload = await readCappedJson<{ fullHashes?: GsbFullHash[] }>(response);
 
-  // V5 response: fullHashes[].{ fullHash, fullHashDetails[].{ threatType } }
   // Filter to entries whose full hash matches ours to avoid false positives from prefix collisions
-  const fullHashes: Array<{
-    fullHash: string;
-    fullHashDetails: Array<{ threatType: string }>;
-  }> = payload.fullHashes ?? [];
+  const fullHashes = payload.fullHashes ?? [];
 
   return fullHashes
     .filter(h => h.fullHash === fullHashB64)
     .flatMap(h => h.fullHashDetails);
 }
 
+// The public VirusTotal API allows 4 lookups a minute. After a 429 we stop
+// asking for a minute instead of burning the quota on guaranteed refusals.
+const VT_BACKOFF_MS = 60_000;
+let vtThrottledUntil = 0;
+
+interface VirusTotalResult {
+  malicious: number;
+  suspicious: number;
+  harmless: number;
+  undetected: number;
+  permalink: string;
+}
+
+/**
+ * Fetch VirusTotal's existing report for a URL. This is a lookup only: the
+ * URL is never submitted for a fresh scan, which would publish it to VT's
+ * shared corpus. Resolves null when VT has never seen the URL.
+ */
+async function queryVirusTotal(targetUrl: string, signal: AbortSignal): Promise<VirusTotalResult | null> {
+  if (Date.now() < vtThrottledUntil) {
+    throw new ThrottledError('VirusTotal quota exhausted, backing off');
+  }
+
+  // v3 URL identifiers are the unpadded base64url encoding of the URL
+  const id = Buffer.from(targetUrl).toString('base64url');
+  const response = await fetch(`https://www.virustotal.com/api/v3/urls/${id}`, {
+    headers: {
+      'x-apikey': process.env.VT_API_KEY ?? '',
+      Accept: 'application/json',
+      'User-Agent': userAgent()
+    },
+    signal
+  });
+
+  if (response.status === 429) {
+    vtThrottledUntil = Date.now() + VT_BACKOFF_MS;
+    throw new ThrottledError('VirusTotal rate limit reached');
+  }
+  if (response.status === 404) {
+    return null;
+  }
+  if (!response.ok) {
+    throw new Error(`VirusTotal request failed: ${response.status}`);
+  }
+
+  const payload = await readCappedJson<{
+    data?: {
+      id?: string;
+      attributes?: { last_analysis_stats?: Partial<Record<'malicious' | 'suspicious' | 'harmless' | 'undetected', unknown>> };
+    };
+  }>(response);
+  const stats = payload?.data?.attributes?.last_analysis_stats;
+  if (!stats) {
+    return null;
+  }
+
+  return {
+    malicious: Number(stats.malicious) || 0,
+    suspicious: Number(stats.suspicious) || 0,
+    harmless: Number(stats.harmless) || 0,
+    undetected: Number(stats.undetected) || 0,
+    // data.id is the SHA-256 of VT's canonical form of the URL
+    permalink: `https://www.virustotal.com/gui/url/${payload.data?.id ?? id}`
+  };
+}
+
+interface ThreatFoxIoc {
+  ioc: string;
+  ioc_type: string;
+  threat_type: string;
+  malware: string;
+  /** 0-100: how sure the reporter is that the IOC is malicious. */
+  confidence_level: number;
+  first_seen: string | null;
+  last_seen: string | null;
+}
+
+/**
+ * Search ThreatFox for IOCs (domains, IP:port pairs, URLs) matching the
+ * destination host. Resolves an empty list on `no_result`; any other
+ * non-`ok` status (bad search term, rejected Auth-Key) is an error.
+ */
+async function fetchThreatFox(host: string, signal: AbortSignal): Promise<ThreatFoxIoc[]> {
+  const response = await fetch('https://threatfox-api.abuse.ch/api/v1/', {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      Accept: 'application/json',
+      'User-Agent': userAgent(),
+      ...abuseChHeaders()
+    },
+    body: JSON.stringify({ query: 'search_ioc', search_term: host }),
+    signal
+  });
+  if (!response.ok) {
+    throw new Error(`ThreatFox request failed: ${response.status}`);
+  }
+
+  // On no_result, `data` is a sentence rather than a list
+  const payload = await readCappedJson<{ query_status?: string; data?: unknown }>(response);
+  if (payload?.query_status === 'no_result') {
+    return [];
+  }
+  if (payload?.query_status !== 'ok' || !Array.isArray(payload.data)) {
+    throw new Error(`ThreatFox query failed: ${payload?.query_status ?? 'unknown status'}`);
+  }
+
+  return payload.data.map((entry: Record<string, unknown>) => ({
+    ioc: String(entry.ioc ?? ''),
+    ioc_type: String(entry.ioc_type ?? ''),
+    threat_type: String(entry.threat_type ?? ''),
+    malware: String(entry.malware_printable ?? entry.malware ?? 'unknown'),
+    confidence_level: Number(entry.confidence_level) || 0,
+    first_seen: typeof entry.first_seen === 'string' ? entry.first_seen : null,
+    last_seen: typeof entry.last_seen === 'string' ? entry.last_seen : null
+  }));
+}
+
 function isIpAddress(input: string): boolean {
   return /^(?:\d{1,3}\.){3}\d{1,3}$/.test(input);
 }
@@ -61,12 +215,8 @@ interface AbuseIpdbResult {
   usageType?: string;
 }
 
-async function queryAbuseIpdb(ipAddress: string): Promise<AbuseIpdbResult | null> {
-  const apiKey = process.env.ABUSEIPDB_API_KEY;
-  if (!apiKey) {
-    console.warn('threat-intel: ABUSEIPDB_API_KEY is not set, skipping lookup');
-    return null;
-  }
+async function queryAbuseIpdb(ipAddress: string, signal: AbortSignal): Promise<AbuseIpdbResult | null> {
+  const apiKey = process.env.ABUSEIPDB_API_KEY ?? '';
 
   const endpoint = new URL('https://api.abuseipdb.com/api/v2/check');
   endpoint.searchParams.set('ipAddress', ipAddress);
@@ -76,16 +226,25 @@ async function queryAbuseIpdb(ipAddress: string): Promise<AbuseIpdbResult | null
     method: 'GET',
     headers: {
       Key: apiKey,
-      Accept: 'application/json'
+      Accept: 'application/json',
+      'User-Agent': userAgent()
     },
-    signal: AbortSignal.timeout(6_000)
+    signal
   });
 
   if (!response.ok) {
     throw new Error(`AbuseIPDB request failed: ${response.status}`);
   }
 
-  const payload = await response.json();
+  const payload = await readCappedJson<{
+    data?: {
+      abuseConfidenceScore?: unknown;
+      totalReports?: unknown;
+      lastReportedAt?: string;
+      countryCode?: string;
+      usageType?: string;
+    };
+  }>(response);
   const data = payload?.data;
   if (!data) {
     return null;
@@ -100,11 +259,144 @@ async function queryAbuseIpdb(ipAddress: string): Promise<AbuseIpdbResult | null
   };
 }
 
-export const handler: Handler = async (event) => {
+function scoreAbuseIpdb(abuse: AbuseIpdbResult): FeedFinding | null {
+  const confidence = abuse.abuseConfidenceScore;
+  const totalReports = abuse.totalReports;
+
+  let score = 0;
+  if (confidence >= 80 || totalReports >= 20) {
+    score = 60;
+  } else if (confidence >= 50 || totalReports >= 10) {
+    score = 40;
+  } else if (confidence >= 25 || totalReports >= 5) {
+    score = 25;
+  }
+  if (score === 0) {
+    return null;
+  }
+
+  const detailParts = [`Confidence ${confidence}/100`, `${totalReports} report${totalReports === 1 ? '' : 's'}`];
+  if (abuse.countryCode) {
+    detailParts.push(`Country ${abuse.countryCode}`);
+  }
+  if (abuse.lastReportedAt) {
+    detailParts.push(`Last seen ${abuse.lastReportedAt}`);
+  }
+  return { code: 'ABUSEIPDB_REPORTED', details: `Malicious IP reputation: ${detailParts.join(', ')}`, score };
+}
+
+function scoreVirusTotal({ malicious, suspicious }: VirusTotalResult): FeedFinding | null {
+  // A single engine flagging a URL is common noise; several agreeing is not
+  let score = 0;
+  if (malicious >= 3) {
+    score = 50;
+  } else if (malicious >= 1 || suspicious >= 3) {
+    score = 25;
+  }
+  if (score === 0) {
+    return null;
+  }
+  return {
+    code: 'VIRUSTOTAL_DETECTIONS',
+    details: `${malicious} engine${malicious === 1 ? '' : 's'} flagged malicious, ${suspicious} suspicious`,
+    score
+  };
+}
+
+function scoreThreatFox(iocs: ThreatFoxIoc[]): FeedFinding | null {
+  if (iocs.length === 0) {
+    return null;
+  }
+  // The most confident report sets the score; low-confidence IOCs still count
+  const confidence = Math.max(...iocs.map(ioc => ioc.confidence_level));
+  let score = 20;
+  if (confidence >= 75) {
+    score = 50;
+  } else if (confidence >= 50) {
+    score = 35;
+  }
+  const families = [...new Set(iocs.map(ioc => ioc.malware))];
+  return {
+    code: 'THREATFOX_IOC',
+    details: `${iocs.length} IOC${iocs.length === 1 ? '' : 's'} (${families.join(', ')}), confidence up to ${confidence}%`,
+    score
+  };
+}
+
+// Every source the handler consults, in the order they are reported. A new
+// feed only needs an entry here.
+const FEEDS: readonly Feed[] = [
+  {
+    name: 'Google Safe Browsing',
+    configured: () => Boolean(process.env.GSB_API_KEY),
+    // Without a key the local pattern check still runs, at a lower score
+    fallback: true,
+    timeoutMs: GSB_TIMEOUT_MS,
+    breaker: new CircuitBreaker('Google Safe Browsing'),
+    async check({ url }, signal) {
+      const matches = await queryGoogleSafeBrowsing(url, signal);
+      if (matches.length === 0) {
+        return { finding: null };
+      }
+      const keyed = Boolean(process.env.GSB_API_KEY);
+      return {
+        finding: {
+          code: keyed ? 'GSB_MATCH' : 'SUSPICIOUS_PATTERN',
+          details: matches.map(match => `Detected: ${match.threatType}`).join(', '),
+          score: keyed ? 40 : 20
+        }
+      };
+    }
+  },
+  {
+    // Only direct IP destinations have an IP reputation to look up
+    name: 'AbuseIPDB',
+    appliesTo: ({ hostIsIp }) => hostIsIp,
+    configured: () => Boolean(process.env.ABUSEIPDB_API_KEY),
+    timeoutMs: ABUSEIPDB_TIMEOUT_MS,
+    breaker: new CircuitBreaker('AbuseIPDB'),
+    async check({ hostname }, signal) {
+      const abuse = await queryAbuseIpdb(hostname, signal);
+      return { finding: abuse ? scoreAbuseIpdb(abuse) : null };
+    }
+  },
+  {
+    // Existing reports only: a URL VT has never seen is no_report, not clean
+    name: 'VirusTotal',
+    configured: () => Boolean(process.env.VT_API_KEY),
+    responseKey: 'virustotal',
+    timeoutMs: VT_TIMEOUT_MS,
+    breaker: new CircuitBreaker('VirusTotal'),
+    async check({ url }, signal) {
+      const result = await queryVirusTotal(url, signal);
+      return result
+        ? { finding: scoreVirusTotal(result), data: result }
+        : { finding: null, data: null, noReport: true };
+    }
+  },
+  {
+    // Same provider as URLHaus, so the same Auth-Key
+    name: 'ThreatFox',
+    configured: () => Boolean(process.env.URLHAUS_API_KEY),
+    responseKey: 'threatfox',
+    timeoutMs: THREATFOX_TIMEOUT_MS,
+    breaker: new CircuitBreaker('ThreatFox'),
+    async check({ hostname }, signal) {
+      const iocs = await fetchThreatFox(hostname, signal);
+      return { finding: scoreThreatFox(iocs), data: iocs };
+    }
+  }
+];
+
+export const handler: Handler = withRequestLog('check-threat-intel', withSecurityHeaders(withEnvelope(withRateLimit(rateLimiter, async (event) => {
   if (event.httpMethod !== 'POST') {
     return { statusCode: 405, body: 'Method Not Allowed' };
   }
 
+  // The summary message follows Accept-Language; codes never change
+  const locale = negotiateLocale(event.headers['accept-language']);
+  const headers = { 'content-type': 'application/json', 'content-language': locale, vary: 'Accept-Language' };
+
   try {
     const { domain, url } = JSON.parse(event.body || '{}');
 
@@ -113,104 +405,86 @@ export const handler: Handler = async (event) => {
     }
 
     const target = url || `http://${domain}`;
-    const parsed = new URL(target);
-    const hostname = parsed.hostname.toLowerCase();
-    const hostIsIp = isIpAddress(hostname);
-    let riskPoints = 0;
-    const threats: Array<{ source: string; details: string; score: number }> = [];
-    const sourcesChecked: string[] = [];
-    // Check 1: Google Safe Browsing (real API or pattern fallback)
+    let parsed: URL;
     try {
-      const matches = await queryGoogleSafeBrowsing(target);
-      sourcesChecked.push('Google Safe Browsing');
-      if (matches.length > 0) {
-        const score = process.env.GSB_API_KEY ? 40 : 20; // Lower score for pattern fallback
-        riskPoints += score;
-        threats.push({
-          source: 'Google Safe Browsing',
-          details: matches.map(match => `Detected: ${match.threatType}`).join(', '),
-          score
-        });
-      }
-    } catch (error) {
-      console.warn('threat-intel: GSB lookup failed', { error, target });
-      sourcesChecked.push('Google Safe Browsing');
+      parsed = new URL(target);
+    } catch {
+      return { statusCode: 400, body: JSON.stringify({ error: 'Invalid URL' }) };
+    }
+    // file:, javascript:, ftp: etc. have no host worth checking and must
+    // never reach the feeds.
+    if (parsed.protocol !== 'http:' && parsed.protocol !== 'https:') {
+      return { statusCode: 400, body: JSON.stringify({ error: 'Only http and https URLs are supported' }) };
     }
+    const hostname = parsed.hostname.toLowerCase();
 
-    // Check 2: AbuseIPDB (only for direct IP destinations)
-    if (hostIsIp && process.env.ABUSEIPDB_API_KEY) {
-      try {
-        const abuse = await queryAbuseIpdb(hostname);
-        sourcesChecked.push('AbuseIPDB');
-
-        if (abuse) {
-          const confidence = abuse.abuseConfidenceScore;
-          const totalReports = abuse.totalReports;
-
-          let score = 0;
-          if (confidence >= 80 || totalReports >= 20) {
-            score = 60;
-          } else if (confidence >= 50 || totalReports >= 10) {
-            score = 40;
-          } else if (confidence >= 25 || totalReports >= 5) {
-            score = 25;
-          }
-
-          if (score > 0) {
-            riskPoints += score;
-            const detailParts = [`Confidence ${confidence}/100`, `${totalReports} report${totalReports === 1 ? '' : 's'}`];
-            if (abuse.countryCode) {
-              detailParts.push(`Country ${abuse.countryCode}`);
-            }
-            if (abuse.lastReportedAt) {
-              detailParts.push(`Last seen ${abuse.lastReportedAt}`);
-            }
-            threats.push({
-              source: 'AbuseIPDB',
-              details: `Malicious IP reputation: ${detailParts.join(', ')}`,
-              score
-            });
-          }
-        }
-      } catch (error) {
-        sourcesChecked.push('AbuseIPDB');
-        console.warn('threat-intel: AbuseIPDB lookup failed', { error, target });
-      }
-    } else if (hostIsIp && !process.env.ABUSEIPDB_API_KEY) {
-      console.warn('threat-intel: AbuseIPDB lookup skipped because ABUSEIPDB_API_KEY is undefined');
+    // Deployment deny/allow lists settle the verdict without touching any feed
+    const verdict = listVerdict(hostname);
+    if (verdict) {
+      const blocked = verdict === 'blocked';
+      const code: ReasonCode = blocked ? 'DENYLISTED' : 'ALLOWLISTED';
+      return {
+        statusCode: 200,
+        headers,
+        body: JSON.stringify({
+          threat_detected: blocked,
+          risk_points: blocked ? 100 : 0,
+          code,
+          message: reasonText(code, locale),
+          threats: blocked
+            ? [{ source: 'Denylist', code: 'DENYLISTED', details: `${hostname} is on the denylist`, score: 100 }]
+            : [],
+          sources_checked: [],
+          sources: [],
+          virustotal: null,
+          threatfox: null,
+          verdict
+        })
+      };
     }
+    const report = await runFeeds(FEEDS, { url: lookupUrl(target), hostname, hostIsIp: isIpAddress(hostname) });
+    const riskPoints = report.riskPoints;
 
     // Determine overall threat level by risk tiers
-    let message = 'No threats detected';
+    let code: ReasonCode = 'NO_THREATS';
     if (riskPoints >= 80) {
-      message = 'High threat level detected';
+      code = 'THREAT_HIGH';
     } else if (riskPoints >= 40) {
-      message = 'Moderate threat indicators found';
+      code = 'THREAT_MODERATE';
     } else if (riskPoints > 0) {
-      message = 'Low threat indicators found';
+      code = 'THREAT_LOW';
     }
 
     return {
       statusCode: 200,
+      headers,
       body: JSON.stringify({
         threat_detected: riskPoints > 0,
         risk_points: Math.min(riskPoints, 100),
-        message,
-        threats,
-        sources_checked: sourcesChecked
+        code,
+        message: reasonText(code, locale),
+        threats: report.threats,
+        sources_checked: report.sourcesChecked,
+        sources: report.sources,
+        ...report.data
       })
     };
   } catch (error) {
     console.error('Threat intel handler failed', error);
     return {
       statusCode: 500,
+      headers,
       body: JSON.stringify({
         threat_detected: false,
         risk_points: 0,
-        message: 'Threat intelligence check failed',
+        code: 'INTEL_FAILED',
+        message: reasonText('INTEL_FAILED', locale),
         threats: [],
-        sources_checked: []
+        sources_checked: [],
+        sources: [],
+        virustotal: null,
+        threatfox: null
       })
     };
   }
-};
+}))));
@@ -1,11 +1,168 @@
+import { createHash } from "node:crypto";
 import type { Handler } from "@netlify/functions";
+import { abuseChHeaders } from "./lib/abuse-ch";
+import { readCappedText } from "./lib/body";
+import { BREAKER_COOLDOWN_MS, BREAKER_THRESHOLD, CircuitBreaker } from "./lib/circuit-breaker";
+import { listVerdict } from "./lib/domain-lists";
+import { envDurationMs, logConfig } from "./lib/env";
+import { withEnvelope } from "./lib/envelope";
+import { withPlainText, type PlainTextRenderer } from "./lib/plain-text";
+import { withRequestLog } from "./lib/request-log";
+import { endpointLimiter, withRateLimit } from "./lib/rate-limit";
+import { HttpStatusError, INTEL_MAX_ATTEMPTS, withRetry } from "./lib/retry";
+import { KEEP_URL_FRAGMENTS, MAX_URL_LENGTH, lookupUrl, sanitizeUrl } from "./lib/sanitize-url";
+import { withSecurityHeaders } from "./lib/security-headers";
+import { MemoryCache, type Cache } from "./lib/ttl-cache";
+import { QRCHECK_VERSION, userAgent } from "./lib/user-agent";
 
-// Use a mainstream browser UA to avoid URLHaus "verify user agent" redirects that break POST lookups
-const UA =
-  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36 QRCheck/Intel";
+// Default to a mainstream browser UA to avoid URLHaus "verify user agent"
+// redirects that break POST lookups; USER_AGENT still overrides it.
+const UA = userAgent(
+  `Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36 QRCheck/${QRCHECK_VERSION}`
+);
 const URLHAUS_URL = "https://urlhaus.abuse.ch/api/v1/url/";
 const URLHAUS_HOST = "https://urlhaus.abuse.ch/api/v1/host/";
-const TIMEOUT_MS = 4500;
+const TIMEOUT_MS = envDurationMs("URLHAUS_TIMEOUT", envDurationMs("INTEL_TIMEOUT", 4500));
+
+// Warm-instance cache, as in check-domain-age: repeat lookups of the same URL
+// skip URLHaus entirely. The same per-verdict windows drive the CDN headers.
+// Clean answers expire within the hour so a freshly listed URL is not hidden
+// for long; listed URLs rarely get delisted, so hits can be kept longer.
+// Failures and odd statuses are not reused unless INTEL_UNKNOWN_TTL says so.
+const CLEAN_TTL_MS = envDurationMs("INTEL_CLEAN_TTL", 60 * 60 * 1000);
+const MALICIOUS_TTL_MS = envDurationMs("INTEL_MALICIOUS_TTL", 6 * 60 * 60 * 1000);
+const UNKNOWN_TTL_MS = envDurationMs("INTEL_UNKNOWN_TTL", 0);
+
+/** URLHaus's record for the URL's host: how many bad URLs it has served. */
+interface UrlhausHostSummary {
+  query_status: string;
+  url_count: number;
+  blacklists: Record<string, string>;
+  error?: string;
+}
+
+/** Whether a listed URL is still serving its payload, as URLHaus last saw it. */
+type UrlStatus = "online" | "offline" | "unknown";
+
+interface UrlhausLookup {
+  query_status: string;
+  matches: unknown[];
+  /**
+   * Status of the listing: "offline" when every matched URL has stopped
+   * serving malware, "online" when any still does. Absent with no matches.
+   */
+  url_status?: UrlStatus;
+  /** Why the lookup failed, when query_status is "failed". */
+  error?: string;
+  /** Host-level result, present on URL lookups so a new path on a bad host still counts. */
+  urlhaus_host?: UrlhausHostSummary | null;
+}
+
+const cache: Cache<UrlhausLookup> = new MemoryCache();
+
+// While URLHaus keeps failing, answer 503 at once instead of waiting out
+// TIMEOUT_MS per request; the client falls back to its local filter.
+const breaker = new CircuitBreaker("URLHaus");
+
+const rateLimiter = endpointLimiter("intel-urlhaus");
+
+logConfig("intel-urlhaus", {
+  urlhaus_timeout_ms: TIMEOUT_MS,
+  intel_max_attempts: INTEL_MAX_ATTEMPTS,
+  keep_url_fragments: KEEP_URL_FRAGMENTS,
+  max_url_length: MAX_URL_LENGTH,
+  breaker_threshold: BREAKER_THRESHOLD,
+  breaker_cooldown_ms: BREAKER_COOLDOWN_MS,
+  rate_limit: rateLimiter.limit,
+  clean_ttl_ms: CLEAN_TTL_MS,
+  malicious_ttl_ms: MALICIOUS_TTL_MS,
+  unknown_ttl_ms: UNKNOWN_TTL_MS
+});
+
+/**
+ * How long a lookup may be reused, by verdict; 0 means never. The exact-URL
+ * lookup is judged first, so a failed one is never cached as a verdict
+ * however the host record came back.
+ */
+function cacheTtl(lookup: UrlhausLookup): number {
+  if (lookup.query_status === "ok") return MALICIOUS_TTL_MS;
+  if (lookup.query_status !== "no_results") return UNKNOWN_TTL_MS;
+  if (lookup.urlhaus_host?.query_status === "ok") return MALICIOUS_TTL_MS;
+  if (lookup.urlhaus_host?.query_status === "error") return UNKNOWN_TTL_MS;
+  return CLEAN_TTL_MS;
+}
+
+/** CDN caching for a verdict; the browser always re-asks, the edge may not. */
+function cdnCacheControl(ttlMs: number): string {
+  const seconds = Math.floor(ttlMs / 1000);
+  return seconds > 0 ? `public, s-maxage=${seconds}, stale-while-revalidate=60` : "no-store";
+}
+
+/** Strong validator for a response body: identical verdicts share a tag. */
+function etagFor(body: string): string {
+  return `"${createHash("sha256").update(body).digest("base64url").slice(0, 27)}"`;
+}
+
+/** If-None-Match may list several tags, or "*"; weak tags compare equal too. */
+function matchesEtag(header: string | undefined, etag: string): boolean {
+  if (!header) return false;
+  return header.split(",").some((tag) => {
+    const t = tag.trim();
+    return t === "*" || t.replace(/^W\//, "") === etag;
+  });
+}
+
+function summarizeHost(
+  result: { query_status?: unknown; url_count?: unknown; blacklists?: unknown; error?: unknown } | null | undefined
+): UrlhausHostSummary | null {
+  if (!result || typeof result.query_status !== "string") return null;
+  return {
+    query_status: result.query_status,
+    url_count: Number(result.url_count) || 0,
+    blacklists: result.blacklists && typeof result.blacklists === "object"
+      ? result.blacklists as Record<string, string>
+      : {},
+    ...(typeof result.error === "string" ? { error: result.error } : {})
+  };
+}
+
+/**
+ * The exact-URL endpoint answers a hit with the record itself rather than a
+ * `urls` list, so fold that into matches too.
+ */
+function matchesOf(result: { urls?: unknown; records?: unknown; url?: unknown; query_status?: unknown } | null | undefined): unknown[] {
+  if (Array.isArray(result?.urls)) return result.urls;
+  if (Array.isArray(result?.records)) return result.records;
+  if (result?.query_status === "ok" && typeof result.url === "string") return [result];
+  return [];
+}
+
+/** One live URL keeps the listing online; it is offline only once all are down. */
+function listingStatus(matches: unknown[]): UrlStatus | undefined {
+  if (matches.length === 0) return undefined;
+  const statuses = matches.map((m) => (m as { url_status?: unknown } | null)?.url_status);
+  if (statuses.includes("online")) return "online";
+  return statuses.every((status) => status === "offline") ? "offline" : "unknown";
+}
+
+/**
+ * Say what actually went wrong talking to URLHaus, so a timeout, a DNS
+ * failure and an upstream 5xx are distinguishable without server logs.
+ * undici hides the system error (ENOTFOUND, ECONNRESET...) in `cause`.
+ */
+function describeError(e: unknown): string {
+  if (typeof e === "object" && e !== null && (e as { name?: string }).name === "AbortError") {
+    return `timeout after ${TIMEOUT_MS}ms`;
+  }
+  if (!(e instanceof Error)) return "lookup error";
+  const code = (e.cause as { code?: unknown } | undefined)?.code;
+  return typeof code === "string" ? `${e.message} (${code})` : e.message;
+}
+
+function schemeOf(u: string): string | null {
+  try { return new URL(u).protocol; }
+  catch { return null; }
+}
 
 function normalizeHost(u: string): string | null {
   try {
@@ -15,10 +172,24 @@ function normalizeHost(u: string): string | null {
   } catch { return null; }
 }
 
+// abuse.ch now requires an Auth-Key on URLHaus API calls. Requests are still
+// attempted without one, but the response says why they may be failing.
+const MISSING_KEY_WARNING = "URLHAUS_API_KEY is not set; abuse.ch may reject unauthenticated lookups";
+
+/** postForm, retrying network errors and 5xx within the request's deadline. */
+function postFormWithRetry(endpoint: string, form: Record<string, string>, signal: AbortSignal) {
+  return withRetry(() => postForm(endpoint, form, signal), { signal });
+}
+
 async function postForm(endpoint: string, form: Record<string, string>, signal: AbortSignal) {
+    const headers: Record<string, string> = {
+      "content-type": "application/x-www-form-urlencoded",
+      "user-agent": UA,
+      ...abuseChHeaders()
+    };
     const res = await fetch(endpoint, {
       method: "POST",
-      headers: { "content-type": "application/x-www-form-urlencoded", "user-agent": UA },
+      headers,
       body: new URLSearchParams(form).toString(),
       redirect: "follow",
       signal
@@ -30,10 +201,10 @@ async function postForm(endpoint: string, form: Record<string, string>, signal:
     }
 
   if (!res.ok) {
-    throw new Error(`HTTP ${res.status}: ${res.statusText}`);
+    throw new HttpStatusError(res.status, res.statusText);
   }
 
-  const text = await res.text();
+  const text = await readCappedText(res);
 
   // URLHaus sometimes replies with a plain "no" body after verify-ua; treat as no results instead of an error
   if (text.trim().toLowerCase() === "no") {
@@ -44,49 +215,144 @@ async function postForm(endpoint: string, form: Record<string, string>, signal:
     return JSON.parse(text);
   } catch (e) {
     console.error('Failed to parse URLHaus response:', text, e);
-    return { query_status: "failed", raw: text };
+    return { query_status: "failed", raw: text, error: "unparseable response from URLHaus" };
   }
 }
 
-export const handler: Handler = async (event) => {
+/** The verdict in a line, plus the host record and any key warning. */
+const renderText: PlainTextRenderer = (body) => {
+  const count = body.matches?.length ?? 0;
+  let verdict: string;
+  if (body.verdict) {
+    verdict = body.verdict === "blocked" ? "blocked by this deployment's denylist" : "trusted by this deployment's allowlist";
+  } else if (count > 0) {
+    const state = body.url_status === "offline" ? "offline, previously malicious but appears inactive" : body.url_status ?? "unknown";
+    verdict = `listed (${count} match${count === 1 ? "" : "es"}, ${state})`;
+  } else if (body.query_status === "no_results") {
+    verdict = "not listed";
+  } else {
+    verdict = `lookup ${body.query_status}${body.error ? `: ${body.error}` : ""}`;
+  }
+
+  const lines = [`urlhaus:  ${verdict}`];
+  const hostCount = body.urlhaus_host?.url_count ?? 0;
+  if (hostCount > 0) lines.push(`host:     ${hostCount} malicious URL${hostCount === 1 ? "" : "s"} on record`);
+  if (body.warning) lines.push(`warning:  ${body.warning}`);
+  return lines;
+};
+
+export const handler: Handler = withRequestLog("intel-urlhaus", withSecurityHeaders(withEnvelope(withPlainText(renderText, withRateLimit(rateLimiter, async (event) => {
+  if (event.httpMethod !== "GET" && event.httpMethod !== "POST") {
+    return { statusCode: 405, body: "Method Not Allowed" };
+  }
+
   try {
-    const body = JSON.parse(event.body || "{}");
-    const inputUrl = typeof body.url === "string" ? body.url : null;
+    // GET takes ?url= / ?host= so lookups are easy from a browser or curl;
+    // POST keeps the original JSON body.
+    const body = event.httpMethod === "GET"
+      ? (event.queryStringParameters ?? {})
+      : JSON.parse(event.body || "{}");
+    const rawUrl = typeof body.url === "string" ? body.url : null;
     const inputHost = typeof body.host === "string" ? body.host : null;
-    if (!inputUrl && !inputHost) {
+    if (!rawUrl && !inputHost) {
       return { statusCode: 400, body: JSON.stringify({ ok: false, error: "missing url or host" }) };
     }
+    if ((rawUrl?.length ?? 0) > MAX_URL_LENGTH || (inputHost?.length ?? 0) > MAX_URL_LENGTH) {
+      return { statusCode: 400, body: JSON.stringify({ ok: false, error: `url or host is longer than ${MAX_URL_LENGTH} characters` }) };
+    }
+    const sanitized = rawUrl ? sanitizeUrl(rawUrl) : null;
+    if (rawUrl && !sanitized) {
+      return { statusCode: 400, body: JSON.stringify({ ok: false, error: "invalid url" }) };
+    }
+    const inputUrl = sanitized ? lookupUrl(sanitized) : null;
 
-    let host = inputHost;
-    if (!host && inputUrl) {
-      host = normalizeHost(inputUrl);
-      if (!host) return { statusCode: 400, body: JSON.stringify({ ok: false, error: "invalid url" }) };
+    const urlHost = inputUrl ? normalizeHost(inputUrl) : null;
+    if (inputUrl && !urlHost) {
+      const error = schemeOf(inputUrl) ? "only http and https URLs are supported" : "invalid url";
+      return { statusCode: 400, body: JSON.stringify({ ok: false, error }) };
     }
+    const host = inputHost ?? urlHost;
 
-    const ctrl = new AbortController();
-    const to = setTimeout(() => ctrl.abort(), TIMEOUT_MS);
+    // Deployment lists answer without asking URLHaus at all
+    const verdict = listVerdict(host!);
+    if (verdict) {
+      return {
+        statusCode: 200,
+        headers: { "content-type": "application/json", "cache-control": "no-store" },
+        body: JSON.stringify({ ok: true, source: "urlhaus", query_status: "skipped", matches: [], verdict })
+      };
+    }
 
-    const result = inputUrl
-      ? await postForm(URLHAUS_URL, { url: inputUrl }, ctrl.signal)
-      : await postForm(URLHAUS_HOST, { host: host! }, ctrl.signal);
+    const cacheKey = inputUrl ? `url:${new URL(inputUrl).toString()}` : `host:${host!.toLowerCase()}`;
+    const cached = await cache.get(cacheKey);
+    let lookup: UrlhausLookup;
 
-    clearTimeout(to);
+    if (cached) {
+      lookup = cached;
+    } else if (!breaker.allow()) {
+      const retryAfter = Math.max(1, Math.ceil(((breaker.retryAt() ?? Date.now()) - Date.now()) / 1000));
+      return {
+        statusCode: 503,
+        headers: { "content-type": "application/json", "cache-control": "no-store", "retry-after": String(retryAfter) },
+        body: JSON.stringify({
+          ok: false,
+          source: "urlhaus",
+          query_status: "unavailable",
+          error: "URLHaus keeps failing; lookups are paused"
+        })
+      };
+    } else {
+      const ctrl = new AbortController();
+      const to = setTimeout(() => ctrl.abort(), TIMEOUT_MS);
 
-    const matches = Array.isArray(result?.urls) ? result.urls
-      : Array.isArray(result?.records) ? result.records
-      : [];
+      // An exact-URL match rarely hits, so URL lookups also ask about the
+      // host. The host query is best-effort and never fails the URL result.
+      const [result, hostResult] = await breaker.run(async () => inputUrl
+        ? Promise.all([
+            postFormWithRetry(URLHAUS_URL, { url: inputUrl }, ctrl.signal),
+            postFormWithRetry(URLHAUS_HOST, { host: host! }, ctrl.signal)
+              .catch((e: unknown) => ({ query_status: "error", error: describeError(e) }))
+          ])
+        : [await postFormWithRetry(URLHAUS_HOST, { host: host! }, ctrl.signal), undefined]
+      ).finally(() => clearTimeout(to));
 
-    return {
-      statusCode: 200,
-      headers: {
-        "content-type": "application/json",
-        "cache-control": "no-store",
-        "netlify-cdn-cache-control": "public, s-maxage=300, stale-while-revalidate=60"
-      },
-      body: JSON.stringify({ ok: true, source: "urlhaus", query_status: result?.query_status || "failed", matches })
+      const matches = matchesOf(result);
+      const urlStatus = listingStatus(matches);
+      lookup = {
+        query_status: result?.query_status || "failed",
+        matches,
+        ...(urlStatus ? { url_status: urlStatus } : {}),
+        ...(typeof result?.error === "string" ? { error: result.error } : {})
+      };
+      if (inputUrl) {
+        lookup.urlhaus_host = summarizeHost(hostResult);
+      }
+
+      await cache.set(cacheKey, lookup, cacheTtl(lookup));
+    }
+
+    const payload = JSON.stringify({
+      ok: true,
+      source: "urlhaus",
+      ...lookup,
+      ...(process.env.URLHAUS_API_KEY ? {} : { warning: MISSING_KEY_WARNING })
+    });
+    const headers = {
+      "content-type": "application/json",
+      "cache-control": "no-store",
+      "netlify-cdn-cache-control": cdnCacheControl(cacheTtl(lookup)),
+      etag: etagFor(payload)
     };
+
+    if (matchesEtag(event.headers["if-none-match"], headers.etag)) {
+      return { statusCode: 304, headers, body: "" };
+    }
+    return { statusCode: 200, headers, body: payload };
   } catch (e: unknown) {
     console.error('URLHaus lookup failed:', e);
-    return { statusCode: 500, body: JSON.stringify({ ok: false, error: e instanceof Error ? e.message : "lookup error" }) };
+    return {
+      statusCode: 500,
+      body: JSON.stringify({ ok: false, source: "urlhaus", query_status: "error", error: describeError(e) })
+    };
   }
-};
+})))));
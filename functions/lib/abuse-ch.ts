@@ -0,0 +1,8 @@
+/**
+ * abuse.ch authenticates URLHaus and ThreatFox with the same Auth-Key, so
+ * one URLHAUS_API_KEY covers both. Calls are still attempted without it.
+ */
+export function abuseChHeaders(): Record<string, string> {
+  const key = process.env.URLHAUS_API_KEY;
+  return key ? { "auth-key": key } : {};
+}
@@ -0,0 +1,48 @@
+import { envInt } from "./env";
+
+/**
+ * Largest upstream response body any function will read, in bytes. Every
+ * feed we call answers in a few KB; the cap only exists so a hostile or
+ * broken upstream cannot stream an unbounded body into function memory.
+ */
+export const MAX_UPSTREAM_BODY_BYTES = envInt("MAX_UPSTREAM_BODY_BYTES", 1024 * 1024);
+
+export class BodyTooLargeError extends Error {
+  constructor(readonly limit: number) {
+    super(`Upstream response exceeded ${limit} bytes`);
+    this.name = "BodyTooLargeError";
+  }
+}
+
+/**
+ * Read a response body as text, aborting as soon as it grows past `limit`
+ * bytes. A Content-Length over the limit is rejected before reading at all.
+ */
+export async function readCappedText(res: Response, limit = MAX_UPSTREAM_BODY_BYTES): Promise<string> {
+  const declared = Number(res.headers.get("content-length"));
+  if (declared > limit) {
+    await res.body?.cancel();
+    throw new BodyTooLargeError(limit);
+  }
+  if (!res.body) return "";
+
+  const reader = res.body.getReader();
+  const chunks: Uint8Array[] = [];
+  let size = 0;
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) break;
+    size += value.byteLength;
+    if (size > limit) {
+      await reader.cancel();
+      throw new BodyTooLargeError(limit);
+    }
+    chunks.push(value);
+  }
+  return Buffer.concat(chunks).toString("utf8");
+}
+
+/** readCappedText followed by JSON.parse. */
+export async function readCappedJson<T>(res: Response, limit = MAX_UPSTREAM_BODY_BYTES): Promise<T> {
+  return JSON.parse(await readCappedText(res, limit)) as T;
+}
@@ -0,0 +1,78 @@
+import { domainToUnicode } from "node:url";
+import { isIP } from "node:net";
+import { envInt, envList } from "./env";
+
+// Domains this deployment protects, e.g. "paypal.com,acme.example". List
+// every domain the brand really owns: a brand name on any other domain counts
+// as impersonation, so paypal.co.uk would be flagged unless it is listed too.
+export const BRAND_WATCHLIST = envList("BRAND_WATCHLIST").map((entry) => entry.toLowerCase().replace(/\.$/, ""));
+export const BRAND_MAX_DISTANCE = envInt("BRAND_MAX_DISTANCE", 2);
+
+// Brand names shorter than this only match exactly; at distance 2 a
+// four-letter name is close to half the dictionary.
+const MIN_FUZZY_LENGTH = 5;
+
+// Look-alike letters folded to the Latin letter they imitate before comparing,
+// so a punycode "pаypal" (Cyrillic а) is as close to paypal as "paypal" is.
+const SKELETON: Record<string, string> = {
+  "а": "a", "е": "e", "о": "o", "р": "p", "с": "c", "у": "y", "х": "x", "і": "i", "ј": "j",
+  "ѕ": "s", "ԁ": "d", "ӏ": "l", "һ": "h", "ԛ": "q", "ԝ": "w", "в": "b", "к": "k", "м": "m",
+  "н": "h", "т": "t", "α": "a", "ο": "o", "κ": "k", "ν": "v", "ρ": "p", "τ": "t", "υ": "u",
+  "ι": "i", "ϲ": "c", "օ": "o", "ս": "u", "հ": "h"
+};
+
+export interface BrandImpersonation {
+  /** Watchlist entry the host imitates. */
+  brand: string;
+  /** Edit distance from the brand name to the closest part of the host, look-alike letters folded; 0 = the name itself. */
+  distance: number;
+}
+
+function skeleton(label: string): string {
+  return [...label].map((ch) => SKELETON[ch] ?? ch).join("");
+}
+
+function levenshtein(a: string, b: string): number {
+  let prev = Array.from({ length: b.length + 1 }, (_, j) => j);
+  for (let i = 1; i <= a.length; i++) {
+    const row = [i];
+    for (let j = 1; j <= b.length; j++) {
+      row[j] = Math.min(prev[j] + 1, row[j - 1] + 1, prev[j - 1] + (a[i - 1] === b[j - 1] ? 0 : 1));
+    }
+    prev = row;
+  }
+  return prev[b.length];
+}
+
+/**
+ * Compare a host against the brand watchlist. Every label except the TLD,
+ * and every hyphen-separated part of one, is folded to its Latin skeleton
+ * and measured against each brand's name (its first label): paypaI.com and
+ * pаypal.com are one edit or less away, paypal-secure.com and
+ * paypal.com.evil.example carry it verbatim. The brand's own domain and its
+ * subdomains never match. Returns the closest match, or null.
+ */
+export function detectBrandImpersonation(
+  hostname: string,
+  brands: readonly string[] = BRAND_WATCHLIST,
+  maxDistance: number = BRAND_MAX_DISTANCE
+): BrandImpersonation | null {
+  const host = hostname.toLowerCase().replace(/\.$/, "");
+  if (brands.length === 0 || isIP(host.replace(/^\[|\]$/g, ""))) return null;
+  if (brands.some((brand) => host === brand || host.endsWith(`.${brand}`))) return null;
+
+  const labels = (domainToUnicode(host) || host).split(".").slice(0, -1).map(skeleton);
+  const parts = new Set(labels.flatMap((label) => [label, ...label.split("-")]).filter(Boolean));
+
+  let best: BrandImpersonation | null = null;
+  for (const brand of brands) {
+    const name = brand.split(".")[0];
+    for (const part of parts) {
+      const distance = part === name ? 0 : name.length < MIN_FUZZY_LENGTH ? Infinity : levenshtein(part, name);
+      if (distance <= maxDistance && (!best || distance < best.distance)) {
+        best = { brand, distance };
+      }
+    }
+  }
+  return best;
+}
@@ -0,0 +1,68 @@
+import { envList } from "./env";
+
+/**
+ * Query parameters that only identify the campaign or click, never the page.
+ * A trailing "*" matches by prefix.
+ */
+export const TRACKING_PARAMS: readonly string[] = [
+  "utm_*",
+  "fbclid",
+  "gclid",
+  "dclid",
+  "msclkid",
+  "yclid",
+  "igshid",
+  "mc_eid",
+  "mc_cid",
+  "_hsenc",
+  "_hsmi"
+];
+
+/**
+ * Parameters canonicalUrl removes: STRIP_PARAMS (comma-separated names, a
+ * trailing "*" for a prefix) replaces TRACKING_PARAMS when set, so a
+ * deployment can both add trackers and keep ones its users rely on.
+ */
+const configuredStripParams = envList("STRIP_PARAMS");
+export const STRIP_PARAMS: readonly string[] =
+  configuredStripParams.length > 0 ? configuredStripParams : TRACKING_PARAMS;
+
+function isTracking(name: string, patterns: readonly string[]): boolean {
+  const lower = name.toLowerCase();
+  return patterns.some((pattern) =>
+    pattern.endsWith("*") ? lower.startsWith(pattern.slice(0, -1).toLowerCase()) : lower === pattern.toLowerCase()
+  );
+}
+
+/**
+ * The URL a clean QR code should encode instead: the destination with
+ * tracking parameters removed. Host and path come from URL parsing unchanged
+ * (lower-cased host, default port dropped); the remaining query parameters
+ * keep their original order and encoding, and the fragment is kept because
+ * single-page apps route on it. Returns null for unparseable input.
+ */
+export function canonicalUrl(url: string, patterns: readonly string[] = STRIP_PARAMS): string | null {
+  let parsed: URL;
+  try {
+    parsed = new URL(url);
+  } catch {
+    return null;
+  }
+
+  const kept = parsed.search
+    .slice(1)
+    .split("&")
+    .filter((pair) => {
+      if (!pair) return false;
+      const rawName = pair.split("=")[0];
+      let name = rawName;
+      try {
+        name = decodeURIComponent(rawName.replace(/\+/g, " "));
+      } catch {
+        // Keep the raw name for matching
+      }
+      return !isTracking(name, patterns);
+    });
+  parsed.search = kept.length > 0 ? `?${kept.join("&")}` : "";
+  return parsed.toString();
+}
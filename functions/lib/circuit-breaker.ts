@@ -0,0 +1,88 @@
+import { envDurationMs, envInt } from "./env";
+
+/** Consecutive failures that open a breaker (BREAKER_THRESHOLD). */
+export const BREAKER_THRESHOLD = envInt("BREAKER_THRESHOLD", 5);
+/** How long an open breaker skips its upstream before letting a probe through (BREAKER_COOLDOWN). */
+export const BREAKER_COOLDOWN_MS = envDurationMs("BREAKER_COOLDOWN", 30_000);
+
+export type BreakerState = "closed" | "open" | "half_open";
+
+/**
+ * Per-upstream circuit breaker. After `threshold` consecutive failures the
+ * upstream is skipped outright for `cooldownMs`, so an outage costs one
+ * fast "unavailable" instead of a full timeout on every request. Once the
+ * cooldown passes a single probe is let through: success closes the
+ * breaker, failure opens it for another cooldown.
+ *
+ * Like the rate limiter, state is per warm instance.
+ */
+export class CircuitBreaker {
+  private failures = 0;
+  private openedAt: number | null = null;
+  private probing = false;
+
+  constructor(
+    readonly name: string,
+    readonly threshold = BREAKER_THRESHOLD,
+    readonly cooldownMs = BREAKER_COOLDOWN_MS
+  ) {}
+
+  state(now = Date.now()): BreakerState {
+    if (this.openedAt === null) return "closed";
+    return now - this.openedAt >= this.cooldownMs ? "half_open" : "open";
+  }
+
+  /** Whether to call the upstream now. In half-open, only one probe at a time. */
+  allow(now = Date.now()): boolean {
+    const state = this.state(now);
+    if (state === "closed") return true;
+    if (state === "open" || this.probing) return false;
+    this.probing = true;
+    return true;
+  }
+
+  /** Epoch ms when the next probe is allowed; null while closed. */
+  retryAt(): number | null {
+    return this.openedAt === null ? null : this.openedAt + this.cooldownMs;
+  }
+
+  /** Call `fn`, recording its outcome. Check allow() first. */
+  async run<T>(fn: () => Promise<T>): Promise<T> {
+    try {
+      const value = await fn();
+      this.success();
+      return value;
+    } catch (e) {
+      this.failure();
+      throw e;
+    }
+  }
+
+  success(): void {
+    if (this.openedAt !== null) {
+      console.log(`circuit-breaker: ${this.name} recovered, closing`);
+    }
+    this.failures = 0;
+    this.openedAt = null;
+    this.probing = false;
+  }
+
+  /**
+   * Give back a probe that ended without a verdict on the upstream's health
+   * (e.g. the feed was throttled), so the next request may probe instead.
+   */
+  release(): void {
+    this.probing = false;
+  }
+
+  failure(now = Date.now()): void {
+    this.failures += 1;
+    if (this.probing || (this.openedAt === null && this.failures >= this.threshold)) {
+      console.warn(`circuit-breaker: ${this.name} failing, skipping it for ${this.cooldownMs}ms`, {
+        consecutive_failures: this.failures
+      });
+      this.openedAt = now;
+    }
+    this.probing = false;
+  }
+}
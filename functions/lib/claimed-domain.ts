@@ -0,0 +1,36 @@
+import { domainToASCII } from "node:url";
+
+export interface ClaimMismatch {
+  /** The domain the poster or sticker showed, normalized. */
+  claimed: string;
+  /** Where the code actually leads. */
+  actual: string;
+}
+
+/**
+ * Normalize a domain a person read off the printed material around a QR code:
+ * scheme, path and a trailing dot are dropped, IDNs become punycode so they
+ * compare with URL hostnames. Returns null when nothing host-like is left.
+ */
+export function normalizeClaimedDomain(raw: string): string | null {
+  const host = raw.trim().toLowerCase()
+    .replace(/^[a-z][a-z0-9+.-]*:\/\//, "")
+    .split(/[/?#]/, 1)[0]
+    .replace(/\.$/, "");
+  if (!host || !host.includes(".") || /[\s@:]/.test(host)) return null;
+  return domainToASCII(host) || null;
+}
+
+/**
+ * Compare the destination host with the domain the surrounding context
+ * claimed, the tell of a sticker pasted over a legitimate code. The claimed
+ * domain's subdomains count as a match, and a leading "www." is ignored on
+ * both sides. Returns both values on a mismatch, otherwise null.
+ */
+export function checkClaimedDomain(claimed: string, hostname: string): ClaimMismatch | null {
+  const strip = (host: string) => host.toLowerCase().replace(/\.$/, "").replace(/^www\./, "");
+  const want = strip(claimed);
+  const actual = strip(hostname);
+  if (actual === want || actual.endsWith(`.${want}`)) return null;
+  return { claimed, actual: hostname.toLowerCase() };
+}
@@ -0,0 +1,106 @@
+/** How the resolver presents itself to each hop. */
+export interface ClientProfile {
+  /** Preset used; "custom" when overrides were sent without one, "default" when nothing was. */
+  name: string;
+  user_agent: string;
+  accept_language: string | null;
+  mobile: boolean;
+}
+
+type Preset = Omit<ClientProfile, "name">;
+
+/**
+ * Browsers a victim would plausibly scan with. Cloaking kits serve their
+ * payload only to phones and a harmless page to anything that looks like a
+ * scanner, so presenting as one of these can reveal a different chain.
+ */
+export const CLIENT_PROFILES: Readonly<Record<string, Preset>> = {
+  "mobile-ios": {
+    user_agent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+    accept_language: "en-US,en;q=0.9",
+    mobile: true
+  },
+  "mobile-android": {
+    user_agent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+    accept_language: "en-US,en;q=0.9",
+    mobile: true
+  },
+  desktop: {
+    user_agent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+    accept_language: "en-US,en;q=0.9",
+    mobile: false
+  }
+};
+
+const MAX_USER_AGENT_LENGTH = 512;
+const MAX_ACCEPT_LANGUAGE_LENGTH = 128;
+// Header values end up on the wire verbatim; nothing that could split them.
+const HEADER_UNSAFE = /[\u0000-\u001f\u007f]/;
+const ACCEPT_LANGUAGE = /^[A-Za-z0-9*,;=. -]+$/;
+
+export interface ClientOverrides {
+  profile?: unknown;
+  user_agent?: unknown;
+  accept_language?: unknown;
+  mobile?: unknown;
+}
+
+/**
+ * Build the client profile a resolve request asked for: a preset, then any
+ * explicit user_agent, accept_language or mobile on top of it. With neither,
+ * the resolver's own identity (`defaultUserAgent`) is used unchanged.
+ * Returns an error message for an unknown preset or a value that is not
+ * safe to send as a header.
+ */
+export function clientProfile(
+  overrides: ClientOverrides,
+  defaultUserAgent: string
+): { profile: ClientProfile } | { error: string } {
+  const { profile, user_agent, accept_language, mobile } = overrides;
+
+  let name = "default";
+  let preset: Preset = { user_agent: defaultUserAgent, accept_language: null, mobile: false };
+  if (profile !== undefined) {
+    if (typeof profile !== "string" || !Object.keys(CLIENT_PROFILES).includes(profile)) {
+      return { error: `profile must be one of ${Object.keys(CLIENT_PROFILES).join(", ")}` };
+    }
+    name = profile;
+    preset = CLIENT_PROFILES[profile];
+  }
+
+  if (user_agent !== undefined &&
+      (typeof user_agent !== "string" || !user_agent.trim() ||
+       user_agent.length > MAX_USER_AGENT_LENGTH || HEADER_UNSAFE.test(user_agent))) {
+    return { error: `user_agent must be a single line of at most ${MAX_USER_AGENT_LENGTH} characters` };
+  }
+  if (accept_language !== undefined &&
+      (typeof accept_language !== "string" ||
+       accept_language.length > MAX_ACCEPT_LANGUAGE_LENGTH || !ACCEPT_LANGUAGE.test(accept_language))) {
+    return { error: "accept_language must be an Accept-Language value, e.g. en-US,en;q=0.9" };
+  }
+  if (mobile !== undefined && typeof mobile !== "boolean") {
+    return { error: "mobile must be a boolean" };
+  }
+
+  const overridden = user_agent !== undefined || accept_language !== undefined || mobile !== undefined;
+  return {
+    profile: {
+      name: name === "default" && overridden ? "custom" : name,
+      user_agent: typeof user_agent === "string" ? user_agent.trim() : preset.user_agent,
+      accept_language: typeof accept_language === "string" ? accept_language : preset.accept_language,
+      mobile: typeof mobile === "boolean" ? mobile : preset.mobile
+    }
+  };
+}
+
+/**
+ * Request headers for `profile`. The default profile sends only the
+ * User-Agent, exactly as before profiles existed; any other also sends the
+ * mobile client hint, which some kits check alongside the UA.
+ */
+export function clientHeaders(profile: ClientProfile): Record<string, string> {
+  const headers: Record<string, string> = { "user-agent": profile.user_agent };
+  if (profile.accept_language) headers["accept-language"] = profile.accept_language;
+  if (profile.name !== "default") headers["sec-ch-ua-mobile"] = profile.mobile ? "?1" : "?0";
+  return headers;
+}
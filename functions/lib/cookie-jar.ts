@@ -0,0 +1,85 @@
+import { isIP } from "node:net";
+
+interface StoredCookie {
+  value: string;
+  /** Host the cookie is scoped to, without a leading dot. */
+  domain: string;
+  /** True when Set-Cookie had no Domain attribute: exact-host match only. */
+  hostOnly: boolean;
+  secure: boolean;
+}
+
+/**
+ * Just enough of RFC 6265 to carry session cookies along one redirect chain:
+ * Domain scoping, Secure, and deletion via Max-Age/Expires. Path is ignored
+ * because a chain rarely revisits a host on a different path, and the jar
+ * lives only as long as a single resolve call.
+ */
+export class CookieJar {
+  private readonly cookies = new Map<string, StoredCookie>();
+
+  /** Apply the Set-Cookie headers a response to `url` carried. */
+  store(url: string, setCookies: string[], now = Date.now()): void {
+    const host = new URL(url).hostname.toLowerCase();
+    for (const line of setCookies) {
+      const [pair, ...attrs] = line.split(";");
+      const eq = pair.indexOf("=");
+      if (eq <= 0) continue;
+      const name = pair.slice(0, eq).trim();
+      const value = pair.slice(eq + 1).trim();
+
+      let domain = host;
+      let hostOnly = true;
+      let secure = false;
+      let expired = false;
+      for (const attr of attrs) {
+        const [rawKey, ...rest] = attr.split("=");
+        const key = rawKey.trim().toLowerCase();
+        const val = rest.join("=").trim();
+        if (key === "domain" && val) {
+          domain = val.replace(/^\./, "").toLowerCase();
+          hostOnly = false;
+        } else if (key === "secure") {
+          secure = true;
+        } else if (key === "max-age" && /^-?\d+$/.test(val)) {
+          expired = Number(val) <= 0;
+        } else if (key === "expires" && !attrs.some((a) => /^\s*max-age=/i.test(a))) {
+          const t = Date.parse(val);
+          expired = !Number.isNaN(t) && t <= now;
+        }
+      }
+
+      // A host may only set cookies for itself or a parent domain, and never
+      // for a bare TLD. IP literals (including bracketed IPv6) have no parent,
+      // so a Domain attribute there is ignored rather than trusted.
+      if (isIP(host.replace(/^\[|\]$/g, ""))) {
+        domain = host;
+        hostOnly = true;
+      } else if (!hostOnly && (!domain.includes(".") || (host !== domain && !host.endsWith(`.${domain}`)))) {
+        continue;
+      }
+
+      const key = `${domain}\t${name}`;
+      if (expired) {
+        this.cookies.delete(key);
+      } else {
+        this.cookies.set(key, { value, domain, hostOnly, secure });
+      }
+    }
+  }
+
+  /** The Cookie header to send to `url`, or null when nothing applies. */
+  header(url: string): string | null {
+    const target = new URL(url);
+    const host = target.hostname.toLowerCase();
+    const pairs: string[] = [];
+    for (const [key, cookie] of this.cookies) {
+      if (cookie.secure && target.protocol !== "https:") continue;
+      const matches = cookie.hostOnly
+        ? host === cookie.domain
+        : host === cookie.domain || host.endsWith(`.${cookie.domain}`);
+      if (matches) pairs.push(`${key.split("\t")[1]}=${cookie.value}`);
+    }
+    return pairs.length > 0 ? pairs.join("; ") : null;
+  }
+}
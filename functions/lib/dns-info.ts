@@ -0,0 +1,48 @@
+import { Resolver } from "node:dns/promises";
+import { isIP } from "node:net";
+
+export interface DnsInfo {
+  /** A and AAAA records of the host (the address itself for IP literals). */
+  addresses: string[];
+  /** Reverse-DNS names of the first address. */
+  ptr: string[];
+}
+
+/** The subset of dns/promises.Resolver we use; swapped for a stub in tests. */
+export interface DnsResolverLike {
+  resolve4(hostname: string): Promise<string[]>;
+  resolve6(hostname: string): Promise<string[]>;
+  reverse(ip: string): Promise<string[]>;
+}
+
+const DNS_TIMEOUT_MS = 2000;
+
+// One try per query: this is context for the analyst, not worth stalling
+// the response for.
+const defaultResolver = new Resolver({ timeout: DNS_TIMEOUT_MS, tries: 1 });
+
+const orEmpty = (p: Promise<string[]>) => p.catch(() => [] as string[]);
+
+/**
+ * Look up where a host points. NXDOMAIN, SERVFAIL and timeouts all degrade
+ * to empty lists; this never throws. The first address is not reverse-resolved
+ * when `isPrivate` says it is internal: the platform's resolver may hold PTR
+ * names for internal ranges that must not reach the response.
+ */
+export async function lookupDns(
+  hostname: string,
+  resolver: DnsResolverLike = defaultResolver,
+  isPrivate: (ip: string) => boolean = () => false
+): Promise<DnsInfo> {
+  const bare = hostname.replace(/^\[|\]$/g, "");
+  let addresses: string[];
+  if (isIP(bare)) {
+    addresses = [bare];
+  } else {
+    const [v4, v6] = await Promise.all([orEmpty(resolver.resolve4(bare)), orEmpty(resolver.resolve6(bare))]);
+    addresses = [...v4, ...v6];
+  }
+
+  const ptr = addresses.length > 0 && !isPrivate(addresses[0]) ? await orEmpty(resolver.reverse(addresses[0])) : [];
+  return { addresses, ptr };
+}
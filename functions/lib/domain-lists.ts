@@ -0,0 +1,57 @@
+import { readFileSync } from "node:fs";
+
+/**
+ * Parse a domain list file: one entry per line, "#" starts a comment, blank
+ * lines are skipped. Entries are lower-cased and lose any trailing dot.
+ */
+export function parseDomainList(text: string): string[] {
+  return text
+    .split(/\r?\n/)
+    .map((line) => line.replace(/#.*/, "").trim().toLowerCase().replace(/\.$/, ""))
+    .filter(Boolean);
+}
+
+/**
+ * Read the list named by env var `name`, a path relative to the site root.
+ * The file must be bundled with the functions (netlify.toml included_files).
+ * A missing or unreadable file is logged and treated as an empty list, so a
+ * bad path never takes the lookups down with it.
+ */
+function loadDomainList(name: string): string[] {
+  const path = process.env[name]?.trim();
+  if (!path) return [];
+  try {
+    return parseDomainList(readFileSync(path, "utf8"));
+  } catch (error) {
+    console.error(`domain-lists: cannot read ${name}=${path}; the list is empty`, error);
+    return [];
+  }
+}
+
+// Deployment-specific verdicts that skip the feeds entirely, e.g. a company
+// trusting its own domains or blocking a campaign before the feeds catch up.
+// Read once per cold start: a function instance never outlives a deploy, and
+// redeploying is how a changed list ships.
+const DENYLIST = loadDomainList("DENYLIST_FILE");
+const ALLOWLIST = loadDomainList("ALLOWLIST_FILE");
+
+export type ListVerdict = "blocked" | "trusted";
+
+/**
+ * True when `hostname` is on the list. A plain entry matches that exact host;
+ * "*.example.com" matches any subdomain of example.com but not example.com
+ * itself, so list both to cover the apex too.
+ */
+export function matchesDomainList(hostname: string, entries: string[]): boolean {
+  const host = hostname.toLowerCase().replace(/\.$/, "");
+  return entries.some((entry) =>
+    entry.startsWith("*.") ? host.endsWith(entry.slice(1)) : host === entry
+  );
+}
+
+/** The configured verdict for a host, or null when neither list has it. The denylist wins. */
+export function listVerdict(hostname: string): ListVerdict | null {
+  if (matchesDomainList(hostname, DENYLIST)) return "blocked";
+  if (matchesDomainList(hostname, ALLOWLIST)) return "trusted";
+  return null;
+}
@@ -0,0 +1,124 @@
+/** A destination URL hidden inside another URL rather than sent as a redirect. */
+export interface EmbeddedRedirect {
+  /** `data_url` for a data: payload, `query_param` for a base64 parameter value. */
+  source: "data_url" | "query_param";
+  /** Query parameter that carried the payload (query_param only). */
+  param?: string;
+  /** The decoded inner URL. */
+  url: string;
+}
+
+// Base64 of "http" is "aHR0c"; anything shorter than a bare https://a.b
+// cannot hold a URL, and requiring the alphabet keeps plain words out.
+const BASE64_VALUE = /^[A-Za-z0-9+/_-]{16,}={0,2}$/;
+
+const META_REFRESH = /<meta[^>]+http-equiv\s*=\s*["']?refresh["']?[^>]*content\s*=\s*["'][^"']*url\s*=\s*['"]?([^"'\s>]+)/i;
+const FIRST_URL = /https?:\/\/[^\s"'<>()]+/i;
+
+/** Parse text as an absolute http(s) URL, or null. */
+function asHttpUrl(text: string): string | null {
+  const trimmed = text.trim();
+  if (!/^https?:\/\//i.test(trimmed)) return null;
+  try {
+    return new URL(trimmed).toString();
+  } catch {
+    return null;
+  }
+}
+
+/** Decode standard or URL-safe base64, tolerating missing padding. */
+function decodeBase64(value: string): string {
+  return Buffer.from(value.replace(/-/g, "+").replace(/_/g, "/"), "base64").toString("utf8");
+}
+
+/** The URL a data: payload would send the browser to: a meta refresh, else the first URL in it. */
+function fromDataUrl(raw: string): string | null {
+  const comma = raw.indexOf(",");
+  if (comma < 0) return null;
+  const meta = raw.slice(5, comma);
+  let body: string;
+  try {
+    body = decodeURIComponent(raw.slice(comma + 1));
+  } catch {
+    body = raw.slice(comma + 1);
+  }
+  const text = /;base64$/i.test(meta) ? decodeBase64(body.replace(/\s+/g, "")) : body;
+  const target = META_REFRESH.exec(text)?.[1] ?? FIRST_URL.exec(text)?.[0];
+  return target ? asHttpUrl(target) : null;
+}
+
+/** Query parameters of `parsed` whose values are, or base64-decode to, an http(s) URL. */
+function urlParams(parsed: URL): Array<{ param: string; url: string; encoded: boolean }> {
+  const found: Array<{ param: string; url: string; encoded: boolean }> = [];
+  for (const [param, value] of parsed.searchParams) {
+    const plain = asHttpUrl(value);
+    if (plain) {
+      found.push({ param, url: plain, encoded: false });
+      continue;
+    }
+    // An unescaped "+" in a query string arrives as a space
+    const candidate = value.replace(/ /g, "+");
+    if (!BASE64_VALUE.test(candidate)) continue;
+    const decoded = asHttpUrl(decodeBase64(candidate));
+    if (decoded) found.push({ param, url: decoded, encoded: true });
+  }
+  return found;
+}
+
+/**
+ * Find a destination smuggled inside `raw`: a data: URL whose HTML or text
+ * points elsewhere, or a query parameter (?url=, ?next=, or any other name)
+ * holding a base64-encoded http(s) URL. Only decoded values that parse as a
+ * URL count, so ordinary tokens and IDs never match.
+ */
+export function findEmbeddedRedirect(raw: string): EmbeddedRedirect | null {
+  if (/^data:/i.test(raw)) {
+    const url = fromDataUrl(raw);
+    return url ? { source: "data_url", url } : null;
+  }
+
+  let parsed: URL;
+  try {
+    parsed = new URL(raw);
+  } catch {
+    return null;
+  }
+  const encoded = urlParams(parsed).find((p) => p.encoded);
+  return encoded ? { source: "query_param", param: encoded.param, url: encoded.url } : null;
+}
+
+/** A hop that bounced the chain to another site named in its own query string. */
+export interface OpenRedirectHop {
+  /** Index into the chain of the hop whose parameter was used. */
+  hop: number;
+  param: string;
+  /** The URL the parameter named. */
+  target: string;
+}
+
+/**
+ * Spot a chain routed through someone's open redirect, e.g.
+ * trusted.example/out?url=https://evil.example/: a hop carries a URL for a
+ * different host in a query parameter (plain or base64), and the very next
+ * hop lands on that host. Requiring the jump to actually happen keeps
+ * ordinary ?continue= and ?return= parameters that were not followed quiet.
+ */
+export function findOpenRedirect(hops: string[]): OpenRedirectHop | null {
+  for (let i = 0; i < hops.length - 1; i++) {
+    let current: URL;
+    let next: URL;
+    try {
+      current = new URL(hops[i]);
+      next = new URL(hops[i + 1]);
+    } catch {
+      continue;
+    }
+    for (const { param, url } of urlParams(current)) {
+      const target = new URL(url);
+      if (target.hostname !== current.hostname && target.hostname === next.hostname) {
+        return { hop: i, param, target: url };
+      }
+    }
+  }
+  return null;
+}
@@ -0,0 +1,42 @@
+/**
+ * Read a positive integer from the environment. Unset, empty, or malformed
+ * values fall back to the default rather than failing the function.
+ */
+export function envInt(name: string, fallback: number): number {
+  const raw = process.env[name]?.trim();
+  if (!raw || !/^\d+$/.test(raw)) return fallback;
+  const n = Number(raw);
+  return n > 0 ? n : fallback;
+}
+
+/** Read a comma-separated list from the environment, trimmed, empty items dropped. */
+export function envList(name: string): string[] {
+  return (process.env[name] ?? "")
+    .split(",")
+    .map((item) => item.trim())
+    .filter(Boolean);
+}
+
+/**
+ * Read a duration in milliseconds. Accepts "4500ms", "10s", or a bare number
+ * of seconds (matching RATE_WINDOW). Zero is accepted only when the fallback
+ * is zero too, i.e. for settings where zero already means "off". Anything else
+ * logs a warning and falls back, so a typo never leaves a function with a zero
+ * or NaN timeout.
+ */
+export function envDurationMs(name: string, fallbackMs: number): number {
+  const raw = process.env[name]?.trim();
+  if (!raw) return fallbackMs;
+  const match = /^(\d+)(ms|s)?$/.exec(raw);
+  const ms = match ? Number(match[1]) * (match[2] === "ms" ? 1 : 1000) : 0;
+  if (!match || (ms === 0 && fallbackMs !== 0)) {
+    console.warn(`${name}=${JSON.stringify(raw)} is not a valid duration, using ${fallbackMs}ms`);
+    return fallbackMs;
+  }
+  return ms;
+}
+
+/** Emit the effective configuration once per cold start, in the request-log format. */
+export function logConfig(fn: string, values: Record<string, unknown>): void {
+  console.log(JSON.stringify({ level: "info", msg: "config", function: fn, ...values }));
+}
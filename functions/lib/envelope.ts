@@ -0,0 +1,52 @@
+import type { Handler, HandlerEvent, HandlerResponse } from "@netlify/functions";
+
+/** Bumped only when a response shape changes incompatibly. */
+export const ENVELOPE_VERSION = "1";
+
+export const ENVELOPE_MEDIA_TYPE = "application/vnd.qrcheck.envelope+json";
+
+/** ?envelope=true (or 1), or an Accept header naming the envelope media type. */
+export function wantsEnvelope(event: Pick<HandlerEvent, "queryStringParameters" | "headers">): boolean {
+  const param = event.queryStringParameters?.envelope?.toLowerCase();
+  if (param === "true" || param === "1") return true;
+  return (event.headers?.accept ?? "").toLowerCase().includes(ENVELOPE_MEDIA_TYPE);
+}
+
+function addVary(headers: HandlerResponse["headers"], value: string): string {
+  const existing = String(headers?.vary ?? "");
+  return existing ? `${existing}, ${value}` : value;
+}
+
+/**
+ * Optionally wrap a JSON response as { version, generated_at, data }. Bare
+ * responses stay the default; callers opt in per request. Non-JSON bodies
+ * (405 text, empty 304s) pass through untouched. An enveloped body carries
+ * its own timestamp, so it drops the bare body's ETag and is never cached.
+ */
+export function withEnvelope(handler: Handler): Handler {
+  return async (event, context) => {
+    const response = (await handler(event, context)) as HandlerResponse;
+    const headers = { ...response.headers, vary: addVary(response.headers, "Accept") };
+    if (!wantsEnvelope(event) || !response.body) {
+      return { ...response, headers };
+    }
+
+    let data: unknown;
+    try {
+      data = JSON.parse(response.body);
+    } catch {
+      return { ...response, headers };
+    }
+    delete headers.etag;
+    return {
+      ...response,
+      headers: {
+        ...headers,
+        "content-type": "application/json",
+        "cache-control": "no-store",
+        "netlify-cdn-cache-control": "no-store"
+      },
+      body: JSON.stringify({ version: ENVELOPE_VERSION, generated_at: new Date().toISOString(), data })
+    };
+  };
+}
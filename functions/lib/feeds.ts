@@ -0,0 +1,154 @@
+import type { CircuitBreaker } from './circuit-breaker';
+import type { ReasonCode } from './reasons';
+
+/**
+ * How a feed's lookup went: only `ok` means it actually vouched for the URL.
+ * `no_report` means it answered but has no record of the target, so it has
+ * no opinion either way. `unavailable` means its circuit breaker is open and
+ * it was not asked.
+ */
+export type SourceStatus = 'ok' | 'no_report' | 'error' | 'not_configured' | 'timeout' | 'throttled' | 'unavailable';
+
+/** Thrown by a feed that is backing off from its provider's rate limit. */
+export class ThrottledError extends Error {
+  name = 'ThrottledError';
+}
+
+export function outcomeStatus(outcome: PromiseSettledResult<unknown>): SourceStatus {
+  if (outcome.status === 'fulfilled') return 'ok';
+  // AbortSignal.timeout() rejects with a TimeoutError DOMException
+  const name = (outcome.reason as { name?: string } | null)?.name;
+  if (name === 'ThrottledError') return 'throttled';
+  return name === 'TimeoutError' || name === 'AbortError' ? 'timeout' : 'error';
+}
+
+/** What every feed is asked about. */
+export interface FeedTarget {
+  url: string;
+  /** Lower-cased host of `url`. */
+  hostname: string;
+  hostIsIp: boolean;
+}
+
+export interface FeedFinding {
+  code: ReasonCode;
+  details: string;
+  score: number;
+}
+
+export interface FeedResult {
+  /** Null when the feed has nothing against the target. */
+  finding: FeedFinding | null;
+  /** Raw result echoed under `responseKey`, when the feed has one. */
+  data?: unknown;
+  /** The feed answered but has no record of the target; reported as `no_report`, not `ok`. */
+  noReport?: true;
+}
+
+/**
+ * One threat-intel source. Adding a feed means writing one of these and
+ * listing it; the runner handles concurrency, status reporting and scoring.
+ */
+export interface Feed {
+  /** Name used in `threats`, `sources` and `sources_checked`. */
+  name: string;
+  /** Whether the feed has any opinion on this target; omitted from `sources` when false. */
+  appliesTo?(target: FeedTarget): boolean;
+  /** Whether the credentials the feed needs are present. */
+  configured(): boolean;
+  /** Still run check() when unconfigured, e.g. a local heuristic standing in for the API. */
+  fallback?: boolean;
+  /** Top-level response key for FeedResult.data; always present, null by default. */
+  responseKey?: string;
+  /** This feed's own budget; a slow feed times out alone without holding up the rest. */
+  timeoutMs: number;
+  /** Skips the feed while it keeps failing; throttling is the feed's own back-off and never counts. */
+  breaker?: CircuitBreaker;
+  /** Look the target up; `signal` aborts when timeoutMs runs out. */
+  check(target: FeedTarget, signal: AbortSignal): Promise<FeedResult>;
+}
+
+/** Settle with `work`, or reject with the signal's reason if it aborts first. */
+function withDeadline<T>(work: Promise<T>, signal: AbortSignal): Promise<T> {
+  return new Promise((resolve, reject) => {
+    const onAbort = () => reject(signal.reason);
+    if (signal.aborted) {
+      onAbort();
+      return;
+    }
+    signal.addEventListener('abort', onAbort, { once: true });
+    work.then(resolve, reject).finally(() => signal.removeEventListener('abort', onAbort));
+  });
+}
+
+function runWithTimeout(feed: Feed, target: FeedTarget): Promise<FeedResult> {
+  // AbortSignal.timeout() aborts with a TimeoutError, which outcomeStatus maps
+  const signal = AbortSignal.timeout(feed.timeoutMs);
+  return withDeadline(feed.check(target, signal), signal);
+}
+
+export interface FeedReport {
+  riskPoints: number;
+  threats: Array<{ source: string } & FeedFinding>;
+  sourcesChecked: string[];
+  sources: Array<{ name: string; status: SourceStatus }>;
+  /** FeedResult.data keyed by each feed's responseKey. */
+  data: Record<string, unknown>;
+}
+
+/**
+ * Ask every applicable feed about `target` concurrently, so latency is bounded
+ * by the slowest one rather than their sum. Each feed runs against its own
+ * timeoutMs and reports `timeout` when it overruns, even if it ignores the
+ * signal. A failure in one feed is logged and reported in its status but
+ * never prevents the others from scoring. A feed whose breaker is open is
+ * reported `unavailable` without being called. Results are reported in
+ * `feeds` order.
+ */
+export async function runFeeds(feeds: readonly Feed[], target: FeedTarget): Promise<FeedReport> {
+  const active = feeds
+    .filter((feed) => feed.appliesTo?.(target) ?? true)
+    .map((feed) => {
+      const configured = feed.configured();
+      return { feed, configured, tripped: configured && feed.breaker ? !feed.breaker.allow() : false };
+    });
+  const outcomes = await Promise.allSettled(
+    active.map(({ feed, configured, tripped }) =>
+      (configured || feed.fallback) && !tripped ? runWithTimeout(feed, target) : Promise.resolve(null)
+    )
+  );
+
+  const report: FeedReport = { riskPoints: 0, threats: [], sourcesChecked: [], sources: [], data: {} };
+  active.forEach(({ feed, configured, tripped }, i) => {
+    const outcome = outcomes[i];
+    if (feed.responseKey) report.data[feed.responseKey] = null;
+    if (tripped) {
+      report.sources.push({ name: feed.name, status: 'unavailable' });
+      return;
+    }
+    const status = configured ? outcomeStatus(outcome) : 'not_configured';
+    if (configured && feed.breaker) {
+      if (status === 'ok') feed.breaker.success();
+      else if (status === 'throttled') feed.breaker.release();
+      else feed.breaker.failure();
+    }
+    const noReport = status === 'ok' && outcome.status === 'fulfilled' && outcome.value?.noReport;
+    // A fallback ran, but the feed itself was never asked
+    report.sources.push({ name: feed.name, status: noReport ? 'no_report' : status });
+    if (!configured && !feed.fallback) return;
+    report.sourcesChecked.push(feed.name);
+
+    if (outcome.status === 'rejected') {
+      console.warn(`threat-intel: ${feed.name} lookup failed`, { error: outcome.reason, target: target.url });
+      return;
+    }
+    if (!outcome.value) return;
+    if (feed.responseKey) report.data[feed.responseKey] = outcome.value.data ?? null;
+    const finding = outcome.value.finding;
+    if (finding) {
+      report.riskPoints += finding.score;
+      report.threats.push({ source: feed.name, ...finding });
+    }
+  });
+  return report;
+}
@@ -0,0 +1,46 @@
+import { readCappedJson } from "./body";
+import { userAgent } from "./user-agent";
+
+export type GeoInfo =
+  | { configured: false }
+  | { configured: true; ip: string; country: string | null; region: string | null; asn: string | null; org: string | null }
+  | { configured: true; ip: string; error: string };
+
+const GEOIP_TIMEOUT_MS = 2000;
+
+/**
+ * Locate an IP with ipinfo.io. Like the other keyed feeds, a missing
+ * IPINFO_TOKEN is reported as not configured rather than as an error, and a
+ * failed lookup never fails the caller.
+ */
+export async function fetchGeoIP(ip: string): Promise<GeoInfo> {
+  const token = process.env.IPINFO_TOKEN;
+  if (!token) return { configured: false };
+
+  try {
+    const endpoint = new URL(`https://ipinfo.io/${encodeURIComponent(ip)}/json`);
+    endpoint.searchParams.set("token", token);
+    const response = await fetch(endpoint, {
+      headers: { Accept: "application/json", "User-Agent": userAgent() },
+      signal: AbortSignal.timeout(GEOIP_TIMEOUT_MS)
+    });
+    if (!response.ok) {
+      throw new Error(`ipinfo request failed: ${response.status}`);
+    }
+
+    // org is "AS15169 Google LLC"; split the ASN off so it can be matched on
+    const data = await readCappedJson<{ country?: string; region?: string; org?: string }>(response);
+    const org = data.org?.match(/^(AS\d+)\s*(.*)$/);
+    return {
+      configured: true,
+      ip,
+      country: data.country ?? null,
+      region: data.region ?? null,
+      asn: org ? org[1] : null,
+      org: org ? org[2] || null : data.org ?? null
+    };
+  } catch (error) {
+    console.warn("geoip: lookup failed", { ip, error });
+    return { configured: true, ip, error: error instanceof Error ? error.message : "lookup failed" };
+  }
+}
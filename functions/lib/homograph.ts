@@ -0,0 +1,61 @@
+import { domainToUnicode } from "node:url";
+import { isIP } from "node:net";
+
+export interface HomographResult {
+  /** Hostname as sent on the wire (punycode for IDNs). */
+  ascii: string;
+  /** Hostname as a browser would render it. */
+  unicode: string;
+  /** True when any label is punycode-encoded (xn--). */
+  punycode: boolean;
+  homograph_suspected: boolean;
+}
+
+// Scripts whose letters are routinely mistaken for Latin ones.
+const CONFUSABLE_SCRIPTS = ["Cyrillic", "Greek", "Armenian", "Cherokee"];
+
+// Non-Latin letters that render (near-)identically to a Latin letter. A label
+// made only of these is a whole-script spoof, e.g. Cyrillic "аррӏе".
+const LATIN_LOOKALIKES = new Set([..."аеорсухіјѕԁӏһԛԝвкмнт" + "αοκνρτυιϲ" + "օսհ"]);
+
+function scriptsIn(label: string): Set<string> {
+  const scripts = new Set<string>();
+  for (const ch of label) {
+    if (/\p{Script=Latin}/u.test(ch)) scripts.add("Latin");
+    else for (const script of CONFUSABLE_SCRIPTS) {
+      if (new RegExp(`\\p{Script=${script}}`, "u").test(ch)) scripts.add(script);
+    }
+  }
+  return scripts;
+}
+
+function isSpoofedLabel(label: string): boolean {
+  const scripts = scriptsIn(label);
+  // Latin mixed with a look-alike script in one label: "аpple"
+  if (scripts.has("Latin") && scripts.size > 1) return true;
+  // Entirely look-alike letters from a single confusable script: "аррӏе"
+  const letters = [...label].filter((ch) => /\p{L}/u.test(ch));
+  return !scripts.has("Latin") && scripts.size === 1 && letters.length > 0 &&
+    letters.every((ch) => LATIN_LOOKALIKES.has(ch));
+}
+
+/**
+ * Inspect a hostname for IDN homograph spoofing. Legitimate IDNs (münchen.de,
+ * пример.рф) pass; labels mixing Latin with Cyrillic/Greek look-alikes, or
+ * spelled entirely in look-alike letters, are flagged. URL parsing already
+ * converts hosts to punycode, so the check runs on the decoded form.
+ */
+export function detectHomograph(hostname: string): HomographResult {
+  const ascii = hostname.toLowerCase();
+  if (isIP(ascii.replace(/^\[|\]$/g, ""))) {
+    return { ascii, unicode: ascii, punycode: false, homograph_suspected: false };
+  }
+
+  const unicode = domainToUnicode(ascii) || ascii;
+  return {
+    ascii,
+    unicode,
+    punycode: ascii.split(".").some((label) => label.startsWith("xn--")),
+    homograph_suspected: unicode.split(".").some(isSpoofedLabel)
+  };
+}
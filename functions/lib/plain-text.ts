@@ -0,0 +1,49 @@
+import type { Handler, HandlerEvent, HandlerResponse } from "@netlify/functions";
+
+/**
+ * True when text/plain is the client's first choice: highest q-value, ties
+ * going to the earlier entry. curl's default "*\/*" and browsers keep JSON.
+ */
+export function wantsPlainText(event: Pick<HandlerEvent, "headers">): boolean {
+  const ranked = (event.headers?.accept ?? "")
+    .split(",")
+    .map((part, index) => {
+      const [type, ...params] = part.trim().toLowerCase().split(";");
+      const q = params.map((p) => p.trim()).find((p) => p.startsWith("q="));
+      return { type: type.trim(), q: q ? Number(q.slice(2)) : 1, index };
+    })
+    .filter(({ type, q }) => type && q > 0)
+    .sort((a, b) => b.q - a.q || a.index - b.index);
+  return ranked[0]?.type === "text/plain";
+}
+
+/** Turns a function's JSON body into the lines of its plain-text summary. */
+export type PlainTextRenderer = (body: Record<string, any>) => string[];
+
+/**
+ * Serve a compact, human-readable summary instead of JSON to clients that
+ * ask for text/plain, e.g. `curl -H 'Accept: text/plain'` from a terminal.
+ * JSON stays the default. Errors render as a single "error:" line; non-JSON
+ * and empty bodies pass through. Text never carries the JSON body's ETag.
+ */
+export function withPlainText(render: PlainTextRenderer, handler: Handler): Handler {
+  return async (event, context) => {
+    const response = (await handler(event, context)) as HandlerResponse;
+    if (!wantsPlainText(event) || !response.body) {
+      return response;
+    }
+
+    let body: Record<string, any>;
+    try {
+      body = JSON.parse(response.body);
+    } catch {
+      return response;
+    }
+    const lines = response.statusCode >= 400 || body.ok === false
+      ? [`error: ${typeof body.error === "string" ? body.error : `HTTP ${response.statusCode}`}`]
+      : render(body);
+    const headers = { ...response.headers, "content-type": "text/plain; charset=utf-8" };
+    delete headers.etag;
+    return { ...response, headers, body: `${lines.join("\n")}\n` };
+  };
+}
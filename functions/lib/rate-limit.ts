@@ -0,0 +1,233 @@
+import { BlockList, isIP } from "node:net";
+import type { Handler, HandlerResponse } from "@netlify/functions";
+import { envInt, envList } from "./env";
+
+export interface RateLimitDecision {
+  allowed: boolean;
+  /** Epoch ms when the next request will be admitted; set when refused. */
+  resetTime?: number;
+  /** Whole requests the client can still make right now. */
+  remaining: number;
+  /** Epoch ms when the client's bucket is back to full capacity. */
+  fullAt: number;
+}
+
+/**
+ * Token-bucket, per-key request limiter. Each key holds up to `limit` tokens
+ * and regains them at a steady `limit` per `windowMs`, so a client can burst
+ * up to `limit` requests but sustained traffic is smoothed to the configured
+ * rate instead of being hard-blocked until a window boundary.
+ *
+ * State lives in module scope of the function that owns it, so it resets on
+ * cold start and is not shared across instances — a speed bump for abusive
+ * clients, not a global quota. Idle clients are swept every `sweepIntervalMs`
+ * so a warm instance on a public endpoint doesn't grow without bound.
+ */
+export class RateLimiter {
+  private readonly buckets = new Map<string, { tokens: number; updated: number }>();
+  private readonly refillPerMs: number;
+  private lastSweep = 0;
+
+  constructor(
+    readonly limit: number,
+    readonly windowMs: number,
+    private readonly sweepIntervalMs = windowMs
+  ) {
+    this.refillPerMs = limit / windowMs;
+  }
+
+  /** Number of clients currently tracked. */
+  get size(): number {
+    return this.buckets.size;
+  }
+
+  /**
+   * Forget clients whose bucket has refilled to capacity — they are
+   * indistinguishable from a client never seen. Runs from check() because
+   * functions have no background timers between invocations.
+   */
+  sweep(now = Date.now()): void {
+    for (const [key, bucket] of this.buckets) {
+      if (bucket.tokens + (now - bucket.updated) * this.refillPerMs >= this.limit) {
+        this.buckets.delete(key);
+      }
+    }
+    this.lastSweep = now;
+  }
+
+  check(key: string, now = Date.now()): RateLimitDecision {
+    if (now - this.lastSweep >= this.sweepIntervalMs) {
+      this.sweep(now);
+    }
+
+    const bucket = this.buckets.get(key) ?? { tokens: this.limit, updated: now };
+    bucket.tokens = Math.min(this.limit, bucket.tokens + (now - bucket.updated) * this.refillPerMs);
+    bucket.updated = now;
+    this.buckets.set(key, bucket);
+
+    const allowed = bucket.tokens >= 1;
+    if (allowed) {
+      bucket.tokens -= 1;
+    }
+    const quota = {
+      remaining: Math.floor(bucket.tokens),
+      fullAt: now + Math.ceil((this.limit - bucket.tokens) / this.refillPerMs)
+    };
+
+    return allowed
+      ? { allowed, ...quota }
+      : { allowed, resetTime: now + Math.ceil((1 - bucket.tokens) / this.refillPerMs), ...quota };
+  }
+}
+
+/**
+ * X-RateLimit-* headers for a decision, so clients can pace themselves before
+ * hitting a 429. Reset is when the bucket is full again, in epoch seconds.
+ */
+export function rateLimitHeaders(limit: number, decision: RateLimitDecision): Record<string, string> {
+  return {
+    "x-ratelimit-limit": String(limit),
+    "x-ratelimit-remaining": String(decision.remaining),
+    "x-ratelimit-reset": String(Math.ceil(decision.fullAt / 1000))
+  };
+}
+
+/** Proxy hops in front of Netlify that append to X-Forwarded-For (TRUST_PROXY, 0 = none). */
+export const TRUST_PROXY_HOPS = envInt("TRUST_PROXY", 0);
+
+/** Strip an optional port (and IPv6 brackets) and return the address if it is a valid IP. */
+function parseAddress(value: string | undefined): string | null {
+  if (!value) return null;
+  let addr = value.trim();
+  const bracketed = addr.match(/^\[([^\]]+)\](?::\d+)?$/);
+  if (bracketed) {
+    addr = bracketed[1];
+  } else if (/^[^:]+:\d+$/.test(addr)) {
+    addr = addr.slice(0, addr.lastIndexOf(":"));
+  }
+  return isIP(addr) ? addr.toLowerCase() : null;
+}
+
+/**
+ * Identify the client for rate limiting. Netlify's edge sets
+ * x-nf-client-connection-ip, which the client cannot forge. When deployed
+ * behind further proxies, `trustedHops` (TRUST_PROXY) says how many of them
+ * append to X-Forwarded-For: the client is the entry that many places from
+ * the right, and anything further left is client-supplied and ignored.
+ * Without trusted hops X-Forwarded-For is never consulted.
+ */
+export function getClientIP(
+  headers: Record<string, string | undefined>,
+  trustedHops = TRUST_PROXY_HOPS
+): string {
+  const edge = parseAddress(headers["x-nf-client-connection-ip"]);
+  if (edge) return edge;
+
+  if (trustedHops > 0 && headers["x-forwarded-for"]) {
+    const chain = headers["x-forwarded-for"].split(",");
+    const forwarded = parseAddress(chain[Math.max(0, chain.length - trustedHops)]);
+    if (forwarded) return forwarded;
+  }
+
+  return "unknown";
+}
+
+/**
+ * Parse RATE_LIMITS ("resolve:20,intel-urlhaus:30") into per-function limits.
+ * Entries without a positive integer are ignored with a warning.
+ */
+export function parseRateLimits(entries: string[]): Map<string, number> {
+  const limits = new Map<string, number>();
+  for (const entry of entries) {
+    const match = /^([\w-]+)\s*:\s*(\d+)$/.exec(entry);
+    if (match && Number(match[2]) > 0) {
+      limits.set(match[1], Number(match[2]));
+    } else {
+      console.warn(`RATE_LIMITS entry ${JSON.stringify(entry)} is not name:count, ignoring it`);
+    }
+  }
+  return limits;
+}
+
+const RATE_LIMITS = parseRateLimits(envList("RATE_LIMITS"));
+
+/**
+ * Parse RATE_LIMIT_ALLOWLIST ("198.51.100.7,203.0.113.0/24,2001:db8::/32")
+ * into the set of clients that are never throttled. Entries that are not an
+ * IP or a CIDR are ignored with a warning.
+ */
+export function parseAllowlist(entries: string[]): BlockList {
+  const allowlist = new BlockList();
+  for (const entry of entries) {
+    const [address, prefix, ...rest] = entry.split("/");
+    const family = isIP(address);
+    const bits = Number(prefix);
+    if (family && prefix === undefined) {
+      allowlist.addAddress(address, family === 6 ? "ipv6" : "ipv4");
+    } else if (family && rest.length === 0 && /^\d+$/.test(prefix) && bits <= (family === 6 ? 128 : 32)) {
+      allowlist.addSubnet(address, bits, family === 6 ? "ipv6" : "ipv4");
+    } else {
+      console.warn(`RATE_LIMIT_ALLOWLIST entry ${JSON.stringify(entry)} is not an IP or CIDR, ignoring it`);
+    }
+  }
+  return allowlist;
+}
+
+/** Monitoring and health checkers that skip the limiter (RATE_LIMIT_ALLOWLIST). */
+export const RATE_LIMIT_ALLOWLIST = parseAllowlist(envList("RATE_LIMIT_ALLOWLIST"));
+
+function isAllowlisted(ip: string, allowlist: BlockList): boolean {
+  const family = isIP(ip);
+  return family !== 0 && allowlist.check(ip, family === 6 ? "ipv6" : "ipv4");
+}
+
+/**
+ * The limiter for one function. RATE_LIMITS can give each function its own
+ * requests-per-window; unlisted ones use RATE_LIMIT. Each function already
+ * runs in its own instances, so buckets are per client and per endpoint.
+ */
+export function endpointLimiter(name: string): RateLimiter {
+  // RATE_WINDOW and RATE_SWEEP_INTERVAL are in seconds
+  const windowMs = envInt("RATE_WINDOW", 60) * 1000;
+  return new RateLimiter(
+    RATE_LIMITS.get(name) ?? envInt("RATE_LIMIT", 10),
+    windowMs,
+    envInt("RATE_SWEEP_INTERVAL", windowMs / 1000) * 1000
+  );
+}
+
+/**
+ * Refuse clients over their quota with a 429 and Retry-After before the
+ * handler runs. Every response carries the X-RateLimit-* headers, except
+ * for allowlisted clients, which bypass the limiter and never use a token.
+ */
+export function withRateLimit(
+  limiter: RateLimiter,
+  handler: Handler,
+  allowlist: BlockList = RATE_LIMIT_ALLOWLIST
+): Handler {
+  return async (event, context) => {
+    const client = getClientIP(event.headers);
+    if (isAllowlisted(client, allowlist)) {
+      return handler(event, context);
+    }
+
+    const decision = limiter.check(client);
+    const quota = rateLimitHeaders(limiter.limit, decision);
+
+    if (!decision.allowed) {
+      return {
+        statusCode: 429,
+        headers: {
+          ...quota,
+          "content-type": "application/json",
+          "retry-after": Math.max(1, Math.ceil((decision.resetTime! - Date.now()) / 1000)).toString()
+        },
+        body: JSON.stringify({ ok: false, error: "Rate limit exceeded", resetTime: decision.resetTime })
+      };
+    }
+
+    const response = (await handler(event, context)) as HandlerResponse;
+    return { ...response, headers: { ...quota, ...response.headers } };
+  };
+}
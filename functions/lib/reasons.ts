@@ -0,0 +1,96 @@
+/**
+ * Stable, machine-readable codes for the verdict text the functions return.
+ * Clients should key on these rather than on the English strings; codes are
+ * only ever added, never renamed or reused.
+ */
+export type ReasonCode =
+  // check-domain-age
+  | "DOMAIN_VERY_NEW"
+  | "DOMAIN_NEW"
+  | "DOMAIN_ESTABLISHED"
+  | "DOMAIN_AGE"
+  | "DOMAIN_NOT_FOUND"
+  | "DOMAIN_AGE_UNKNOWN"
+  | "DOMAIN_AGE_FAILED"
+  // check-threat-intel summary
+  | "THREAT_HIGH"
+  | "THREAT_MODERATE"
+  | "THREAT_LOW"
+  | "NO_THREATS"
+  | "INTEL_FAILED"
+  | "DENYLISTED"
+  | "ALLOWLISTED"
+  // check-threat-intel findings
+  | "GSB_MATCH"
+  | "SUSPICIOUS_PATTERN"
+  | "ABUSEIPDB_REPORTED"
+  | "VIRUSTOTAL_DETECTIONS"
+  | "THREATFOX_IOC";
+
+export type Locale = "en" | "fr";
+
+export const SUPPORTED_LOCALES: readonly Locale[] = ["en", "fr"];
+
+// Summary templates; {days} and {years} are filled from the result. Findings
+// carry feed-specific detail and stay in English, identified by their code.
+const MESSAGES: Record<Locale, Partial<Record<ReasonCode, string>>> = {
+  en: {
+    DOMAIN_VERY_NEW: "Very new domain ({days} days old)",
+    DOMAIN_NEW: "New domain ({days} days old)",
+    DOMAIN_ESTABLISHED: "Established domain ({years} years old)",
+    DOMAIN_AGE: "Domain {days} days old",
+    DOMAIN_NOT_FOUND: "No registration record found for this domain",
+    DOMAIN_AGE_UNKNOWN: "Domain age could not be determined",
+    DOMAIN_AGE_FAILED: "Domain age check failed",
+    THREAT_HIGH: "High threat level detected",
+    THREAT_MODERATE: "Moderate threat indicators found",
+    THREAT_LOW: "Low threat indicators found",
+    NO_THREATS: "No threats detected",
+    INTEL_FAILED: "Threat intelligence check failed",
+    DENYLISTED: "Blocked by this deployment's denylist",
+    ALLOWLISTED: "Trusted by this deployment's allowlist"
+  },
+  fr: {
+    DOMAIN_VERY_NEW: "Domaine très récent ({days} jours)",
+    DOMAIN_NEW: "Domaine récent ({days} jours)",
+    DOMAIN_ESTABLISHED: "Domaine établi ({years} ans)",
+    DOMAIN_AGE: "Domaine âgé de {days} jours",
+    DOMAIN_NOT_FOUND: "Aucun enregistrement trouvé pour ce domaine",
+    DOMAIN_AGE_UNKNOWN: "L'âge du domaine n'a pas pu être déterminé",
+    DOMAIN_AGE_FAILED: "La vérification de l'âge du domaine a échoué",
+    THREAT_HIGH: "Niveau de menace élevé détecté",
+    THREAT_MODERATE: "Indicateurs de menace modérés",
+    THREAT_LOW: "Faibles indicateurs de menace",
+    NO_THREATS: "Aucune menace détectée",
+    INTEL_FAILED: "La vérification des menaces a échoué",
+    DENYLISTED: "Bloqué par la liste de refus de ce déploiement",
+    ALLOWLISTED: "Approuvé par la liste d'autorisation de ce déploiement"
+  }
+};
+
+/**
+ * Pick the best supported locale from an Accept-Language header, honouring
+ * q-values and matching on the primary subtag (fr-CA -> fr). Falls back to
+ * English.
+ */
+export function negotiateLocale(acceptLanguage: string | undefined): Locale {
+  if (!acceptLanguage) return "en";
+  const ranked = acceptLanguage
+    .split(",")
+    .map((part, index) => {
+      const [tag, ...params] = part.trim().split(";");
+      const q = params.map((p) => /^\s*q=([\d.]+)\s*$/i.exec(p)?.[1]).find(Boolean);
+      return { lang: tag.trim().toLowerCase().split("-")[0], q: q === undefined ? 1 : Number(q), index };
+    })
+    .filter((entry) => entry.q > 0)
+    .sort((a, b) => b.q - a.q || a.index - b.index);
+  return ranked.map((entry) => entry.lang).find((lang): lang is Locale =>
+    (SUPPORTED_LOCALES as readonly string[]).includes(lang)
+  ) ?? "en";
+}
+
+/** Render a code's message in `locale`, filling {placeholders} from `vars`. */
+export function reasonText(code: ReasonCode, locale: Locale = "en", vars: Record<string, string | number> = {}): string {
+  const template = MESSAGES[locale][code] ?? MESSAGES.en[code] ?? code;
+  return template.replace(/\{(\w+)\}/g, (match, key: string) => (key in vars ? String(vars[key]) : match));
+}
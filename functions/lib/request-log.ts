@@ -0,0 +1,36 @@
+import { randomUUID } from "node:crypto";
+import type { Handler, HandlerResponse } from "@netlify/functions";
+import { getClientIP } from "./rate-limit";
+
+/**
+ * Wrap a function handler so every invocation emits one JSON log line
+ * (method, path, client, status, duration) tagged with a request ID. The ID
+ * is echoed in X-Request-ID so a user reporting a wrong verdict can quote it
+ * and we can find the matching log line. Netlify's own x-nf-request-id is
+ * reused when present.
+ */
+export function withRequestLog(name: string, handler: Handler): Handler {
+  return async (event, context) => {
+    const requestId = event.headers["x-nf-request-id"] || randomUUID();
+    const started = Date.now();
+    let status = 500;
+
+    try {
+      const response = (await handler(event, context)) as HandlerResponse;
+      status = response.statusCode;
+      return { ...response, headers: { ...response.headers, "x-request-id": requestId } };
+    } finally {
+      console.log(JSON.stringify({
+        level: status >= 500 ? "error" : "info",
+        msg: "request",
+        function: name,
+        request_id: requestId,
+        method: event.httpMethod,
+        path: event.path,
+        client_ip: getClientIP(event.headers),
+        status,
+        duration_ms: Date.now() - started
+      }));
+    }
+  };
+}
@@ -0,0 +1,70 @@
+import { envInt } from "./env";
+
+/** An upstream answered, but with an error status. */
+export class HttpStatusError extends Error {
+  constructor(readonly status: number, statusText: string) {
+    super(`HTTP ${status}: ${statusText}`);
+    this.name = "HttpStatusError";
+  }
+}
+
+/** Tries per feed call, the first included; 1 turns retries off. */
+export const INTEL_MAX_ATTEMPTS = envInt("INTEL_MAX_ATTEMPTS", 2);
+
+/**
+ * Worth asking again: the request never got an answer (fetch reports DNS,
+ * refused and reset connections as a TypeError) or the upstream failed with a
+ * 5xx. A 4xx would fail the same way twice, and a timeout or abort means the
+ * caller's deadline is already spent.
+ */
+export function isRetryable(e: unknown): boolean {
+  if (e instanceof HttpStatusError) return e.status >= 500;
+  return e instanceof TypeError;
+}
+
+/** Wait `ms`, rejecting with the signal's reason if it aborts first. */
+function sleep(ms: number, signal?: AbortSignal): Promise<void> {
+  return new Promise((resolve, reject) => {
+    if (signal?.aborted) {
+      reject(signal.reason);
+      return;
+    }
+    const timer = setTimeout(() => {
+      signal?.removeEventListener("abort", onAbort);
+      resolve();
+    }, ms);
+    function onAbort() {
+      clearTimeout(timer);
+      reject(signal!.reason);
+    }
+    signal?.addEventListener("abort", onAbort, { once: true });
+  });
+}
+
+export interface RetryOptions {
+  /** Total tries, defaulting to INTEL_MAX_ATTEMPTS. */
+  attempts?: number;
+  /** Wait before the first retry; each further retry waits twice as long. */
+  baseDelayMs?: number;
+  /** The caller's overall deadline: no retry starts, or waits, past it. */
+  signal?: AbortSignal;
+}
+
+/**
+ * Run `fn`, retrying transient failures (see isRetryable) with exponential
+ * backoff. The last error is rethrown once the attempts or the deadline run
+ * out; anything not retryable is rethrown straight away.
+ */
+export async function withRetry<T>(
+  fn: () => Promise<T>,
+  { attempts = INTEL_MAX_ATTEMPTS, baseDelayMs = 200, signal }: RetryOptions = {}
+): Promise<T> {
+  for (let attempt = 1; ; attempt++) {
+    try {
+      return await fn();
+    } catch (e) {
+      if (attempt >= attempts || !isRetryable(e) || signal?.aborted) throw e;
+      await sleep(baseDelayMs * 2 ** (attempt - 1), signal);
+    }
+  }
+}
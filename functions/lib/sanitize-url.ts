@@ -0,0 +1,62 @@
+import { envInt } from "./env";
+
+/**
+ * Longest URL a function accepts, checked on the raw input before any parsing
+ * or lookup: a megabyte data: URI or query string is never worth a feed call.
+ */
+export const MAX_URL_LENGTH = envInt("MAX_URL_LENGTH", 8192);
+
+/**
+ * C0/C1 controls, plus the invisible format characters (zero-width, bidi
+ * overrides, BOM) that can make a URL read differently from where it goes.
+ */
+const CONTROL_CHARS = /[\u0000-\u001f\u007f-\u009f\u200b-\u200f\u202a-\u202e\u2060-\u2064\u2066-\u2069\ufeff]/;
+
+// Damage sloppy decoders and copy-paste do to an http(s) prefix:
+// "http ://", "https//", "https:/", and the defanged "hxxp://".
+const SCHEME_TYPOS: ReadonlyArray<[RegExp, string]> = [
+  [/^h(?:tt|xx)p(s?)\s*:\s*\/\s*\/\s*/i, "http$1://"],
+  [/^h(?:tt|xx)p(s?)\s*:\s*\/(?!\/)/i, "http$1://"],
+  [/^h(?:tt|xx)p(s?)\/\//i, "http$1://"]
+];
+
+// "name:" starts a scheme unless digits follow, as in "example.com:8080/".
+const HAS_SCHEME = /^[a-z][a-z0-9+.-]*:(?!\d)/i;
+
+/**
+ * Clean up a URL as it came out of a QR code before anything parses it:
+ * trim surrounding whitespace, repair a mangled http(s) prefix, and default
+ * a bare "example.com/path" to https. Other schemes are left alone so the
+ * caller can still refuse them by name. Returns null for empty input or any
+ * embedded control character, since no legitimate link carries one. Never
+ * throws; whether the result parses is still up to the caller.
+ */
+export function sanitizeUrl(raw: string): string | null {
+  const trimmed = raw.trim();
+  if (!trimmed || CONTROL_CHARS.test(trimmed)) return null;
+
+  let url = trimmed;
+  for (const [pattern, replacement] of SCHEME_TYPOS) {
+    if (pattern.test(url)) {
+      url = url.replace(pattern, replacement);
+      break;
+    }
+  }
+
+  if (url.startsWith("//")) return `https:${url}`;
+  return HAS_SCHEME.test(url) ? url : `https://${url}`;
+}
+
+/** KEEP_URL_FRAGMENTS=true sends the #fragment to the feeds too. */
+export const KEEP_URL_FRAGMENTS = process.env.KEEP_URL_FRAGMENTS === "true";
+
+/**
+ * The form of `url` to ask a feed about and cache under. Browsers never send
+ * the fragment, so it cannot change what the server serves; keeping it would
+ * only miss listings and split cache entries. Deployments that classify on
+ * the fragment can keep it. The rest of the URL is left byte-for-byte alone.
+ */
+export function lookupUrl(url: string, keepFragment = KEEP_URL_FRAGMENTS): string {
+  const hash = url.indexOf("#");
+  return keepFragment || hash === -1 ? url : url.slice(0, hash);
+}
@@ -0,0 +1,47 @@
+import type { Handler, HandlerResponse } from "@netlify/functions";
+
+// Values the Referrer-Policy header accepts; anything else falls back.
+const REFERRER_POLICIES = new Set([
+  "no-referrer",
+  "no-referrer-when-downgrade",
+  "origin",
+  "origin-when-cross-origin",
+  "same-origin",
+  "strict-origin",
+  "strict-origin-when-cross-origin",
+  "unsafe-url"
+]);
+
+/**
+ * REFERRER_POLICY from the environment, defaulting to the same
+ * "no-referrer" netlify.toml sets for the static site.
+ */
+export function referrerPolicy(raw = process.env.REFERRER_POLICY): string {
+  const value = raw?.trim().toLowerCase();
+  if (!value) return "no-referrer";
+  if (!REFERRER_POLICIES.has(value)) {
+    console.warn(`REFERRER_POLICY=${JSON.stringify(raw)} is not a valid policy, using no-referrer`);
+    return "no-referrer";
+  }
+  return value;
+}
+
+const SECURITY_HEADERS: Record<string, string> = {
+  "x-content-type-options": "nosniff",
+  "x-frame-options": "DENY",
+  // Function responses are JSON, never documents: nothing may load or frame them
+  "content-security-policy": "default-src 'none'; frame-ancestors 'none'",
+  "referrer-policy": referrerPolicy()
+};
+
+/**
+ * Add the security headers netlify.toml applies to static files; Netlify
+ * does not apply [[headers]] rules to function responses. A header the
+ * handler sets itself wins.
+ */
+export function withSecurityHeaders(handler: Handler): Handler {
+  return async (event, context) => {
+    const response = (await handler(event, context)) as HandlerResponse;
+    return { ...response, headers: { ...SECURITY_HEADERS, ...response.headers } };
+  };
+}
@@ -0,0 +1,23 @@
+import shortenerData from "../../public/shorteners.json";
+import { envList } from "./env";
+
+// The maintained list is refreshed by scripts/prebuild.mjs before every build
+// (and bundled into the function); SHORTENER_HOSTS adds deployment-specific
+// hosts such as an in-house link service.
+const SHORTENER_HOSTS = new Set<string>([
+  ...shortenerData.domains,
+  ...envList("SHORTENER_HOSTS").map((host) => host.toLowerCase())
+]);
+
+/**
+ * Return the shortener service a hostname belongs to — the listed domain it
+ * equals or is a subdomain of — or null when it isn't a known shortener.
+ */
+export function detectShortener(hostname: string): string | null {
+  const labels = hostname.toLowerCase().replace(/\.$/, "").split(".");
+  for (let i = 0; i < labels.length - 1; i++) {
+    const candidate = labels.slice(i).join(".");
+    if (SHORTENER_HOSTS.has(candidate)) return candidate;
+  }
+  return null;
+}
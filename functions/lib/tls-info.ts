@@ -0,0 +1,82 @@
+import { checkServerIdentity, connect, type PeerCertificate } from "node:tls";
+import type { LookupFunction } from "node:net";
+
+export interface TlsInfo {
+  subject: string | null;
+  issuer: string | null;
+  valid_from: string | null;
+  valid_to: string | null;
+  /** Subject alternative names, with the "DNS:" / "IP Address:" prefixes dropped. */
+  san: string[];
+  self_signed: boolean;
+  expired: boolean;
+  hostname_mismatch: boolean;
+}
+
+const TLS_TIMEOUT_MS = 3000;
+
+function isoDate(raw: string | undefined): string | null {
+  const t = raw ? Date.parse(raw) : NaN;
+  return Number.isNaN(t) ? null : new Date(t).toISOString();
+}
+
+/** Reduce a peer certificate to the fields an analyst compares against the brand. */
+export function summarizeCertificate(cert: PeerCertificate, hostname: string, now = Date.now()): TlsInfo {
+  const validTo = isoDate(cert.valid_to);
+  return {
+    subject: cert.subject?.CN ?? null,
+    issuer: cert.issuer?.O ?? cert.issuer?.CN ?? null,
+    valid_from: isoDate(cert.valid_from),
+    valid_to: validTo,
+    san: (cert.subjectaltname ?? "")
+      .split(",")
+      .map((entry) => entry.trim().replace(/^(DNS|IP Address):/, ""))
+      .filter(Boolean),
+    self_signed: JSON.stringify(cert.subject) === JSON.stringify(cert.issuer),
+    expired: validTo !== null && Date.parse(validTo) < now,
+    hostname_mismatch: checkServerIdentity(hostname, cert) !== undefined
+  };
+}
+
+/**
+ * Handshake with the host of an https URL and summarize its certificate.
+ * Verification is off so self-signed and expired certificates can still be
+ * reported; nothing is sent after the handshake. Plain-http URLs, failures
+ * and timeouts return an empty object. Pass the resolver's SSRF-pinning
+ * lookup so this connection is held to the same address rules as the chain.
+ */
+export function fetchTlsInfo(
+  url: string,
+  lookup?: LookupFunction,
+  timeoutMs = TLS_TIMEOUT_MS
+): Promise<TlsInfo | Record<string, never>> {
+  let target: URL;
+  try {
+    target = new URL(url);
+  } catch {
+    return Promise.resolve({});
+  }
+  if (target.protocol !== "https:") return Promise.resolve({});
+
+  const host = target.hostname.replace(/^\[|\]$/g, "");
+  return new Promise((resolve) => {
+    const socket = connect({
+      host,
+      port: Number(target.port) || 443,
+      servername: /^[\d.]+$|:/.test(host) ? undefined : host,
+      rejectUnauthorized: false,
+      timeout: timeoutMs,
+      ...(lookup ? { lookup } : {})
+    });
+    const done = (info: TlsInfo | Record<string, never>) => {
+      socket.destroy();
+      resolve(info);
+    };
+    socket.once("secureConnect", () => {
+      const cert = socket.getPeerCertificate();
+      done(cert && Object.keys(cert).length > 0 ? summarizeCertificate(cert, host) : {});
+    });
+    socket.once("timeout", () => done({}));
+    socket.once("error", () => done({}));
+  });
+}
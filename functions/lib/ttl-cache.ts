@@ -0,0 +1,40 @@
+/**
+ * What the lookup functions need from a result cache. Async so a shared
+ * backend could stand in for the in-memory one without touching callers.
+ */
+export interface Cache<T> {
+  /** The stored value, or undefined when absent or expired. */
+  get(key: string): Promise<T | undefined>;
+  /** Store `value` for `ttlMs`; a TTL of 0 or less stores nothing. */
+  set(key: string, value: T, ttlMs: number): Promise<void>;
+}
+
+/**
+ * Warm-instance cache: Netlify reuses function containers between
+ * invocations, so repeat lookups within an instance skip the upstream call.
+ * When full it starts over rather than tracking recency; entries are cheap
+ * to refetch and the bound only exists to cap memory.
+ */
+export class MemoryCache<T> implements Cache<T> {
+  private readonly entries = new Map<string, { value: T; expires: number }>();
+
+  constructor(private readonly maxEntries = 500) {}
+
+  async get(key: string): Promise<T | undefined> {
+    const entry = this.entries.get(key);
+    if (!entry) return undefined;
+    if (entry.expires <= Date.now()) {
+      this.entries.delete(key);
+      return undefined;
+    }
+    return entry.value;
+  }
+
+  async set(key: string, value: T, ttlMs: number): Promise<void> {
+    if (ttlMs <= 0) return;
+    if (this.entries.size >= this.maxEntries && !this.entries.has(key)) {
+      this.entries.clear();
+    }
+    this.entries.set(key, { value, expires: Date.now() + ttlMs });
+  }
+}
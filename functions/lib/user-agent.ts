@@ -0,0 +1,17 @@
+/**
+ * Release identifier for outbound User-Agents. Set QRCHECK_VERSION in the
+ * site's environment (e.g. to the deployed tag) to have upstream operators
+ * see which build is calling them.
+ */
+export const QRCHECK_VERSION = process.env.QRCHECK_VERSION?.trim() || "1.0";
+
+export const DEFAULT_USER_AGENT = `QRCheck-LinkResolver/${QRCHECK_VERSION} (+https://qrcheck.ca)`;
+
+/**
+ * User-Agent for an outbound request: USER_AGENT when an operator has set
+ * one, otherwise the caller's default. Some upstreams block or throttle by
+ * UA, so a single override applies to every feed and the resolver.
+ */
+export function userAgent(fallback = DEFAULT_USER_AGENT): string {
+  return process.env.USER_AGENT?.trim() || fallback;
+}
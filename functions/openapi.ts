@@ -0,0 +1,23 @@
+import type { Handler } from "@netlify/functions";
+import spec from "../contracts/openapi.json";
+import { withRequestLog } from "./lib/request-log";
+import { withSecurityHeaders } from "./lib/security-headers";
+
+// The spec lives in contracts/ next to the JSON schemas; the contract test
+// checks it lists every function, so a new endpoint cannot ship undocumented.
+const body = JSON.stringify(spec);
+
+export const handler: Handler = withRequestLog("openapi", withSecurityHeaders(async (event) => {
+  if (event.httpMethod !== "GET") {
+    return { statusCode: 405, body: "Method Not Allowed" };
+  }
+
+  return {
+    statusCode: 200,
+    headers: {
+      "content-type": "application/json",
+      "cache-control": "public, max-age=3600"
+    },
+    body
+  };
+}));
@@ -1,20 +1,49 @@
 import type { Handler } from "@netlify/functions";
 import { fetch as undiciFetch, Agent } from "undici";
 import { lookup as dnsLookup } from "node:dns";
-import { isIP } from "node:net";
-
-const UA = "QRCheck-LinkResolver/1.0 (+https://qrcheck.ca)";
-const MAX_HOPS = 10;
-const TIMEOUT_MS = 5000;
-const OVERALL_DEADLINE_MS = 10000;
+import { isIP, type LookupFunction } from "node:net";
+import { envDurationMs, envInt, logConfig } from "./lib/env";
+import { withEnvelope } from "./lib/envelope";
+import { withPlainText, type PlainTextRenderer } from "./lib/plain-text";
+import { endpointLimiter, withRateLimit } from "./lib/rate-limit";
+import { withRequestLog } from "./lib/request-log";
+import { MAX_URL_LENGTH, sanitizeUrl } from "./lib/sanitize-url";
+import { withSecurityHeaders } from "./lib/security-headers";
+import { userAgent } from "./lib/user-agent";
+import { STRIP_PARAMS, canonicalUrl } from "./lib/canonical-url";
+import { checkClaimedDomain, normalizeClaimedDomain } from "./lib/claimed-domain";
+import { clientHeaders, clientProfile, type ClientProfile } from "./lib/client-profile";
+import { CookieJar } from "./lib/cookie-jar";
+import { findEmbeddedRedirect, findOpenRedirect, type EmbeddedRedirect } from "./lib/embedded-redirect";
+import { detectShortener } from "./lib/shorteners";
+import { detectHomograph } from "./lib/homograph";
+import { BRAND_MAX_DISTANCE, BRAND_WATCHLIST, detectBrandImpersonation } from "./lib/brand-watchlist";
+import { lookupDns } from "./lib/dns-info";
+import { fetchTlsInfo } from "./lib/tls-info";
+import { fetchGeoIP } from "./lib/geoip";
+
+const UA = userAgent();
+/** Upper bound for any hop limit, whether from MAX_REDIRECTS or `?max=`. */
+export const MAX_HOPS_CEILING = 25;
+// RESOLVE_TIMEOUT bounds the whole chain; no single hop may take longer than
+// 5s or the deadline, whichever is shorter.
+const OVERALL_DEADLINE_MS = envDurationMs("RESOLVE_TIMEOUT", 10000);
+const TIMEOUT_MS = Math.min(5000, OVERALL_DEADLINE_MS);
+// Connection reuse for the resolver's agent. Shorteners recur across scans,
+// so idle sockets are kept long enough for the next scan on a warm instance
+// to skip the TCP and TLS handshakes. 0 connections means no per-host cap.
+const KEEPALIVE_TIMEOUT_MS = envDurationMs("RESOLVE_KEEPALIVE_TIMEOUT", 30_000);
+const MAX_CONNECTIONS_PER_HOST = envInt("RESOLVE_MAX_CONNECTIONS_PER_HOST", 0);
 
 /** Error code attached when a lookup resolves to a blocked address. */
 export const BLOCKED_CODE = "EPRIVATEADDR";
 
-// In-memory rate limiting store (resets on function deployment)
-const rateLimitStore = new Map<string, { count: number; resetTime: number }>();
-const RATE_LIMIT_REQUESTS = 10;
-const RATE_LIMIT_WINDOW_MS = 60000; // 1 minute
+// Local testing only: lets the resolver reach localhost and private ranges
+// (e.g. a redirect fixture on 127.0.0.1). Never set this on a deployed site.
+const ALLOW_PRIVATE_IPS = process.env.ALLOW_PRIVATE_IPS === "true";
+
+// In-memory rate limiting (resets on function deployment)
+const rateLimiter = endpointLimiter("resolve");
 
 function ipv4ToInt(ip: string): number | null {
   const parts = ip.split(".");
@@ -139,6 +168,65 @@ export function isPrivateHost(hostname: string): boolean {
   return false;
 }
 
+/**
+ * The final host's address worth locating with ipinfo.io, or null. Blocked
+ * chains and private/reserved addresses are never sent: the lookup has
+ * nothing to say about them, and it would hand internal addressing to a
+ * third party along with our token.
+ */
+export function geoTarget(addresses: string[], reason?: ChainStopReason): string | null {
+  if (reason === "blocked" || addresses.length === 0) return null;
+  return isPrivateAddress(addresses[0]) ? null : addresses[0];
+}
+
+/** Why the SSRF guard refused a hop, as reported in its details. */
+export type BlockedReason = 'private_ip' | 'loopback' | 'link_local' | 'metadata_endpoint';
+
+export interface BlockedHop {
+  reason: BlockedReason;
+  /** The refused address: the literal in the URL, or what its name resolved to. Null for localhost names. */
+  ip: string | null;
+}
+
+// Cloud instance metadata services: AWS/GCP/Azure, Alibaba, and AWS over IPv6.
+const METADATA_V4 = ["169.254.169.254", "100.100.100.200"].map(ipv4ToInt);
+const METADATA_V6 = "fd00:ec2:0:0:0:0:0:254";
+
+function blockedReasonV4(v4: number): BlockedReason {
+  if (METADATA_V4.includes(v4)) return "metadata_endpoint";
+  if (inCidr4(v4, "127.0.0.0", 8)) return "loopback";
+  if (inCidr4(v4, "169.254.0.0", 16)) return "link_local";
+  return "private_ip";
+}
+
+/**
+ * Explain a refusal by the SSRF guard for `host`, a URL hostname or a
+ * resolved address that isPrivateHost/isPrivateAddress rejected. Anything
+ * blocked that is not loopback, link-local or a metadata service (RFC 1918,
+ * CGNAT, reserved and documentation ranges) is `private_ip`.
+ */
+export function explainBlock(host: string): BlockedHop {
+  const bare = host.replace(/^\[|\]$/g, "").split("%")[0];
+  const family = isIP(bare);
+  if (family === 4) {
+    const v4 = ipv4ToInt(bare);
+    return { reason: v4 === null ? "private_ip" : blockedReasonV4(v4), ip: bare };
+  }
+  if (family === 6) {
+    const groups = expandIpv6(bare);
+    if (!groups) return { reason: "private_ip", ip: bare };
+    if (groups.map((g) => g.toString(16)).join(":") === METADATA_V6) return { reason: "metadata_endpoint", ip: bare };
+    if (groups.slice(0, 7).every((g) => g === 0) && groups[7] === 1) return { reason: "loopback", ip: bare };
+    const isMapped = groups.slice(0, 5).every((g) => g === 0) && groups[5] === 0xffff;
+    const isNat64 = groups[0] === 0x64 && groups[1] === 0xff9b && groups.slice(2, 6).every((g) => g === 0);
+    if (isMapped || isNat64) return { reason: blockedReasonV4(groups[6] * 0x10000 + groups[7]), ip: bare };
+    if ((groups[0] & 0xffc0) === 0xfe80) return { reason: "link_local", ip: bare };
+    return { reason: "private_ip", ip: bare };
+  }
+  // Only localhost-style names are refused without resolving them
+  return { reason: "loopback", ip: null };
+}
+
 type DnsLookupFn = typeof dnsLookup;
 
 /**
@@ -168,10 +256,11 @@ export function makeSsrfLookup(dns: DnsLookupFn = dnsLookup) {
       }
       const blocked = list.find((a) => isPrivateAddress(a.address));
       if (blocked) {
-        const e: NodeJS.ErrnoException = new Error(
+        const e: NodeJS.ErrnoException & { address?: string } = new Error(
           `Refusing to connect: ${hostname} resolves to non-public address ${blocked.address}`
         );
         e.code = BLOCKED_CODE;
+        e.address = blocked.address;
         return callback(e);
       }
       if (options?.all) return callback(null, list);
@@ -184,14 +273,20 @@ export function makeSsrfLookup(dns: DnsLookupFn = dnsLookup) {
 }
 
 // One agent for the function's lifetime: every connection it opens goes
-// through the validating, pinning lookup above.
+// through the validating, pinning lookup above (unless ALLOW_PRIVATE_IPS).
+const ssrfLookup = ALLOW_PRIVATE_IPS ? undefined : makeSsrfLookup() as unknown as LookupFunction;
 const ssrfSafeAgent = new Agent({
-  connect: { lookup: makeSsrfLookup() as unknown as import("node:net").LookupFunction }
+  connect: ssrfLookup ? { lookup: ssrfLookup } : {},
+  keepAliveTimeout: KEEPALIVE_TIMEOUT_MS,
+  // A server's Keep-Alive hint may shorten the timeout but never extend it
+  keepAliveMaxTimeout: KEEPALIVE_TIMEOUT_MS,
+  connections: MAX_CONNECTIONS_PER_HOST || null
 });
 
 interface MinimalResponse {
   status: number;
-  headers: { get(name: string): string | null };
+  headers: { get(name: string): string | null; getSetCookie?(): string[] };
+  body?: { cancel(): Promise<void> } | null;
 }
 
 type FetchLike = (url: string, init: {
@@ -204,40 +299,56 @@ type FetchLike = (url: string, init: {
 const safeFetch: FetchLike = (url, init) =>
   undiciFetch(url, { ...init, dispatcher: ssrfSafeAgent }) as Promise<MinimalResponse>;
 
-function isBlockedError(error: unknown): boolean {
-  let e = error as { code?: string; cause?: unknown } | null;
+function findBlockedError(error: unknown): { address?: string } | null {
+  let e = error as { code?: string; address?: string; cause?: unknown } | null;
   for (let depth = 0; e && depth < 5; depth++) {
-    if (e.code === BLOCKED_CODE) return true;
-    e = e.cause as { code?: string; cause?: unknown } | null;
+    if (e.code === BLOCKED_CODE) return e;
+    e = e.cause as { code?: string; address?: string; cause?: unknown } | null;
   }
-  return false;
+  return null;
 }
 
-function checkRateLimit(clientIP: string): { allowed: boolean; resetTime?: number } {
-  const now = Date.now();
-  const existing = rateLimitStore.get(clientIP);
-
-  if (!existing || now > existing.resetTime) {
-    // Reset or create new entry
-    const newEntry = { count: 1, resetTime: now + RATE_LIMIT_WINDOW_MS };
-    rateLimitStore.set(clientIP, newEntry);
-    return { allowed: true };
-  }
-
-  if (existing.count >= RATE_LIMIT_REQUESTS) {
-    return { allowed: false, resetTime: existing.resetTime };
-  }
+/**
+ * Parse a hop limit from MAX_REDIRECTS or a `?max=` query parameter.
+ * Returns null unless the value is a positive integer; values above
+ * MAX_HOPS_CEILING are capped rather than rejected.
+ */
+export function parseMaxHops(raw: string | undefined): number | null {
+  if (raw === undefined || !/^\d+$/.test(raw.trim())) return null;
+  const n = Number(raw.trim());
+  if (n < 1) return null;
+  return Math.min(n, MAX_HOPS_CEILING);
+}
 
-  existing.count++;
-  return { allowed: true };
+// Statuses servers use to refuse the HEAD method itself. 403 is included
+// because several CDNs and shorteners answer HEAD with 403 but GET with 3xx.
+const HEAD_REJECTED_STATUSES = new Set([403, 405, 501]);
+
+// Some legitimate marketing shorteners chain more than 10 redirects.
+const MAX_HOPS = parseMaxHops(process.env.MAX_REDIRECTS) ?? 10;
+
+logConfig("resolve", {
+  resolve_timeout_ms: OVERALL_DEADLINE_MS,
+  per_hop_timeout_ms: TIMEOUT_MS,
+  keepalive_timeout_ms: KEEPALIVE_TIMEOUT_MS,
+  max_connections_per_host: MAX_CONNECTIONS_PER_HOST || "unlimited",
+  max_hops: MAX_HOPS,
+  user_agent: UA,
+  allow_private_ips: ALLOW_PRIVATE_IPS,
+  max_url_length: MAX_URL_LENGTH,
+  rate_limit: rateLimiter.limit,
+  rate_window_ms: rateLimiter.windowMs,
+  brand_watchlist: BRAND_WATCHLIST,
+  brand_max_distance: BRAND_MAX_DISTANCE,
+  strip_params: STRIP_PARAMS
+});
+if (ALLOW_PRIVATE_IPS) {
+  console.warn("resolve: ALLOW_PRIVATE_IPS is set, SSRF protection is disabled");
 }
 
-function getClientIP(event: { headers: Record<string, string | undefined> }): string {
-  // Netlify provides the client IP in various headers
-  return event.headers['x-nf-client-connection-ip'] ||
-         event.headers['x-forwarded-for']?.split(',')[0]?.trim() ||
-         event.headers['x-real-ip'] ||
-         'unknown';
+function schemeOf(u: string): string | null {
+  try { return new URL(u).protocol; }
+  catch { return null; }
 }
 
 function isHttpUrl(u: string) {
@@ -246,11 +357,71 @@ function isHttpUrl(u: string) {
 }
 
 /** Why the chain stopped early. Absent when the final destination was reached. */
-export type ChainStopReason = 'redirect_loop' | 'max_hops' | 'timeout' | 'blocked' | 'network_error';
+export type ChainStopReason =
+  'redirect_loop' | 'max_hops' | 'timeout' | 'blocked' | 'network_error' | 'unsupported_scheme';
+
+/** Transport detail for one hop, parallel to `ChainResult.hops`. */
+export interface HopDetail {
+  url: string;
+  /** HTTP status that ended the hop, or null when it was never answered. */
+  status: number | null;
+  /** Method that produced `status`: GET only after a server rejected HEAD. */
+  method: 'HEAD' | 'GET' | null;
+  /** Set when the hop pointed at a private/internal address and was not contacted. */
+  blocked?: BlockedHop;
+  /** Location header exactly as sent (raw mode only), before resolving against the hop URL. */
+  location_raw?: string;
+  /** Absolute URL the raw Location resolved to (raw mode only). */
+  location_resolved?: string;
+  /** Whitelisted response headers, keyed lower-case (headers mode only). */
+  headers?: Record<string, string>;
+  /** Names of the cookies the hop set; values are never kept (headers mode only). */
+  set_cookie?: string[];
+}
+
+/**
+ * Response headers worth showing an analyst: server fingerprints, security
+ * policy, and the CDN/proxy markers phishing kits tend to leave behind.
+ * Anything else is dropped so the opt-in stays small and predictable.
+ */
+export const HOP_HEADERS = [
+  "server",
+  "x-powered-by",
+  "via",
+  "content-type",
+  "content-security-policy",
+  "strict-transport-security",
+  "x-frame-options",
+  "referrer-policy",
+  "cf-ray",
+  "x-served-by",
+  "x-cache",
+  "x-aspnet-version",
+  "x-generator",
+  "x-redirect-by"
+] as const;
+
+/** Longest header value kept; a policy header can run to kilobytes. */
+const MAX_HOP_HEADER_LENGTH = 512;
+
+function cookieName(setCookie: string): string {
+  return setCookie.split(";", 1)[0].split("=", 1)[0].trim();
+}
+
+function captureHeaders(res: MinimalResponse, detail: HopDetail) {
+  const headers: Record<string, string> = {};
+  for (const name of HOP_HEADERS) {
+    const value = res.headers.get(name);
+    if (value !== null) headers[name] = value.slice(0, MAX_HOP_HEADER_LENGTH);
+  }
+  detail.headers = headers;
+  detail.set_cookie = (res.headers.getSetCookie?.() ?? []).map(cookieName).filter(Boolean);
+}
 
 export interface ChainResult {
   resolvedUrl: string;
   hops: string[];
+  details: HopDetail[];
   /** True when the chain may be incomplete (stopped before a final 2xx/4xx). */
   partial: boolean;
   reason?: ChainStopReason;
@@ -262,6 +433,16 @@ export interface ChainOptions {
   overallDeadlineMs?: number;
   /** Transport override for tests. Production uses the SSRF-pinning agent. */
   fetchImpl?: FetchLike;
+  /** Skip the literal private-host check. Defaults to ALLOW_PRIVATE_IPS. */
+  allowPrivate?: boolean;
+  /** Record each verbatim Location header in the hop details. */
+  rawLocations?: boolean;
+  /** Carry Set-Cookie values to later hops, for chains that gate on a session cookie. */
+  cookies?: boolean;
+  /** Record HOP_HEADERS and Set-Cookie names in each hop's details. */
+  responseHeaders?: boolean;
+  /** Browser to present as; defaults to the resolver's own User-Agent. */
+  client?: ClientProfile;
 }
 
 function normalize(url: string): string {
@@ -274,6 +455,34 @@ function normalize(url: string): string {
   }
 }
 
+/**
+ * Collapse runs of consecutive hops whose paths differ only by case or a
+ * trailing slash (e.g. /Promo -> /promo/), keeping the last hop of each run, whose
+ * status is what led out of it. Loop detection already stops a
+ * true revisit, so only these canonicalizing redirects are ever merged, and
+ * a hop is never merged with one further back in the chain.
+ */
+export function dedupeHops(hops: string[], details: HopDetail[]): { hops: string[]; details: HopDetail[] } {
+  // URL parsing already lower-cases scheme and host; the path is compared
+  // case-insensitively without trailing slashes, the query exactly (it can
+  // carry case-sensitive tokens).
+  const key = (url: string) => {
+    try {
+      const u = new URL(normalize(url));
+      return `${u.protocol}//${u.host}${u.pathname.replace(/\/+$/, "").toLowerCase()}${u.search}`;
+    } catch {
+      return url;
+    }
+  };
+  const kept: number[] = [];
+  hops.forEach((hop, i) => {
+    const last = kept[kept.length - 1];
+    if (last !== undefined && key(hops[last]) === key(hop)) kept[kept.length - 1] = i;
+    else kept.push(i);
+  });
+  return { hops: kept.map((i) => hops[i]), details: kept.map((i) => details[i]) };
+}
+
 /**
  * Follow an HTTP redirect chain server-side and return the ordered hops.
  *
@@ -285,55 +494,74 @@ function normalize(url: string): string {
  * the connection agent, which also pins the socket to the validated address so
  * rebinding cannot bypass the check). Response bodies are never downloaded:
  * hops are probed with HEAD only, and a 1-byte ranged GET is issued solely
- * when a server rejects HEAD outright (405/501).
+ * when a server rejects HEAD outright (see HEAD_REJECTED_STATUSES).
  */
 export async function followRedirectChain(url: string, options: ChainOptions = {}): Promise<ChainResult> {
   const maxHops = options.maxHops ?? MAX_HOPS;
   const perHopTimeout = options.perHopTimeoutMs ?? TIMEOUT_MS;
   const overallDeadline = options.overallDeadlineMs ?? OVERALL_DEADLINE_MS;
   const fetchImpl = options.fetchImpl ?? safeFetch;
+  const allowPrivate = options.allowPrivate ?? ALLOW_PRIVATE_IPS;
+  const jar = options.cookies ? new CookieJar() : null;
+  const baseHeaders = options.client ? clientHeaders(options.client) : { "user-agent": UA };
 
   const startTime = Date.now();
   const hops: string[] = [];
+  const details: HopDetail[] = [];
   const visited = new Set<string>();
   let current = url;
 
   for (let i = 0; i <= maxHops; i++) {
     if (i === maxHops) {
-      return { resolvedUrl: current, hops, partial: true, reason: 'max_hops' };
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'max_hops' };
     }
 
     if (Date.now() - startTime > overallDeadline) {
-      return { resolvedUrl: current, hops, partial: true, reason: 'timeout' };
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'timeout' };
     }
 
     let urlObj: URL;
     try {
       urlObj = new URL(current);
     } catch {
-      return { resolvedUrl: current, hops, partial: true, reason: 'network_error' };
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'network_error' };
+    }
+
+    // A redirect may point anywhere (ftp:, file:, javascript:, an app
+    // scheme). Record where it was heading, but only ever fetch http(s).
+    if (urlObj.protocol !== "http:" && urlObj.protocol !== "https:") {
+      hops.push(current);
+      details.push({ url: current, status: null, method: null });
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'unsupported_scheme' };
     }
 
     // SSRF protection, layer 1: never fetch localhost or literal private IPs.
     // The offending hop is still recorded so the user can see where the chain
     // was heading. (Layer 2 — DNS names resolving to private space — is
     // enforced by the agent's pinning lookup and lands in the catch below.)
-    if (isPrivateHost(urlObj.hostname)) {
+    if (!allowPrivate && isPrivateHost(urlObj.hostname)) {
       hops.push(current);
-      return { resolvedUrl: current, hops, partial: true, reason: 'blocked' };
+      details.push({ url: current, status: null, method: null, blocked: explainBlock(urlObj.hostname) });
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'blocked' };
     }
 
     // Redirect loop detection
     const normalized = normalize(current);
     if (visited.has(normalized)) {
-      return { resolvedUrl: current, hops, partial: true, reason: 'redirect_loop' };
+      return { resolvedUrl: current, hops, details, partial: true, reason: 'redirect_loop' };
     }
     visited.add(normalized);
     hops.push(current);
+    const detail: HopDetail = { url: current, status: null, method: null };
+    details.push(detail);
 
     const ctrl = new AbortController();
     const to = setTimeout(() => ctrl.abort(), perHopTimeout);
 
+    const headers: Record<string, string> = { ...baseHeaders };
+    const cookie = jar?.header(current);
+    if (cookie) headers.cookie = cookie;
+
     try {
       // HEAD only: headers are all we need, and destination pages must never
       // receive an automatic content request.
@@ -341,38 +569,56 @@ export async function followRedirectChain(url: string, options: ChainOptions = {
         method: "HEAD",
         redirect: "manual",
         signal: ctrl.signal,
-        headers: { "user-agent": UA }
+        headers
       });
+      detail.method = "HEAD";
 
       // Only when the server refuses the HEAD method itself, retry with a
       // 1-byte ranged GET. Any other HEAD response is taken at face value.
-      if (res.status === 405 || res.status === 501) {
+      if (HEAD_REJECTED_STATUSES.has(res.status)) {
         res = await fetchImpl(current, {
           method: "GET",
           redirect: "manual",
           signal: ctrl.signal,
           headers: {
-            "user-agent": UA,
+            ...headers,
             "range": "bytes=0-0" // Request only first byte to minimize data transfer
           }
         });
+        detail.method = "GET";
+        // Servers that ignore Range would otherwise stream the whole page;
+        // only the status and headers matter, so drop the body unread.
+        await res.body?.cancel().catch(() => {});
       }
 
       clearTimeout(to);
+      detail.status = res.status;
+      if (jar) {
+        jar.store(current, res.headers.getSetCookie?.() ?? []);
+      }
+      if (options.responseHeaders) {
+        captureHeaders(res, detail);
+      }
 
       const loc = res.headers.get("location");
       if (loc && res.status >= 300 && res.status < 400) {
         current = new URL(loc, current).toString();
+        if (options.rawLocations) {
+          detail.location_raw = loc;
+          detail.location_resolved = current;
+        }
         continue;
       }
 
       // Reached a non-redirect response: this is the final destination.
-      return { resolvedUrl: current, hops, partial: false };
+      return { resolvedUrl: current, hops, details, partial: false };
     } catch (error) {
       clearTimeout(to);
       // The pinning lookup rejected a DNS name that resolves to private space.
-      if (isBlockedError(error)) {
-        return { resolvedUrl: current, hops, partial: true, reason: 'blocked' };
+      const blocked = findBlockedError(error);
+      if (blocked) {
+        detail.blocked = blocked.address ? explainBlock(blocked.address) : { reason: "private_ip", ip: null };
+        return { resolvedUrl: current, hops, details, partial: true, reason: 'blocked' };
       }
       // DOMException is not `instanceof Error` on every runtime — match by name
       const aborted = typeof error === 'object' && error !== null &&
@@ -380,57 +626,155 @@ export async function followRedirectChain(url: string, options: ChainOptions = {
       return {
         resolvedUrl: current,
         hops,
+        details,
         partial: true,
         reason: aborted ? 'timeout' : 'network_error'
       };
     }
   }
 
-  return { resolvedUrl: current, hops, partial: true, reason: 'max_hops' };
+  return { resolvedUrl: current, hops, details, partial: true, reason: 'max_hops' };
 }
 
-export const handler: Handler = async (event) => {
+/** Where the chain ends and anything about it worth a second look. */
+export const renderResolveText: PlainTextRenderer = ({ analysis: a }) => {
+  const findings: string[] = [];
+  const blocked = (a.hop_details as HopDetail[] | undefined)?.find((hop) => hop.blocked);
+  if (blocked?.blocked) findings.push(`refused ${blocked.url}: ${blocked.blocked.reason}${blocked.blocked.ip ? ` (${blocked.blocked.ip})` : ""}`);
+  if (a.shortener) findings.push(`shortened by ${a.shortener}`);
+  if (a.homograph?.homograph_suspected) findings.push(`look-alike characters in host (${a.homograph.ascii})`);
+  if (a.brand_impersonation) findings.push(`imitates ${a.brand_impersonation.brand} (distance ${a.brand_impersonation.distance})`);
+  if (a.claim_mismatch) findings.push(`claimed ${a.claim_mismatch.claimed}, leads to ${a.claim_mismatch.actual}`);
+  if (a.open_redirect_abused) findings.push(`open redirect via ?${a.open_redirect_abused.param}= at hop ${a.open_redirect_abused.hop + 1}`);
+  if (a.decoded_redirect) findings.push(`hidden redirect to ${a.decoded_redirect.url}`);
+
+  return [
+    `input:    ${a.input_url}`,
+    `final:    ${a.resolved_url}`,
+    ...(a.client_profile && a.client_profile.name !== "default" ? [`client:   ${a.client_profile.name}`] : []),
+    `hops:     ${a.hop_count}${a.partial ? ` (stopped early: ${a.reason ?? "unknown"})` : ""}`,
+    ...(findings.length ? ["findings:", ...findings.map((f) => `  - ${f}`)] : ["findings: none"])
+  ];
+};
+
+export const handler: Handler = withRequestLog("resolve", withSecurityHeaders(withEnvelope(withPlainText(renderResolveText, withRateLimit(rateLimiter, async (event) => {
   try {
-    // Rate limiting check
-    const clientIP = getClientIP(event);
-    const rateLimitResult = checkRateLimit(clientIP);
+    const body = JSON.parse(event.body || "{}");
+    if (typeof body.url === "string" && body.url.length > MAX_URL_LENGTH) {
+      return {
+        statusCode: 400,
+        headers: { "content-type": "application/json" } as Record<string, string>,
+        body: JSON.stringify({ ok: false, error: `URL is longer than ${MAX_URL_LENGTH} characters` })
+      };
+    }
+    const url = typeof body.url === "string" ? sanitizeUrl(body.url) : null;
+
+    // Input validation
+    const scheme = typeof url === "string" ? schemeOf(url) : null;
+    if (scheme && scheme !== "http:" && scheme !== "https:") {
+      // A data: payload is never fetched, but the page it carries may still
+      // point somewhere; decoding it is local and safe.
+      const embedded = scheme === "data:" ? findEmbeddedRedirect(url) : null;
+      return {
+        statusCode: 400,
+        headers: { "content-type": "application/json" } as Record<string, string>,
+        body: JSON.stringify({
+          ok: false,
+          error: "Only http and https URLs can be resolved",
+          ...(embedded ? { decoded_redirect: embedded } : {})
+        })
+      };
+    }
+    if (!url || typeof url !== "string" || !isHttpUrl(url)) {
+      return {
+        statusCode: 400,
+        headers: { "content-type": "application/json" } as Record<string, string>,
+        body: JSON.stringify({ ok: false, error: "Invalid URL format" })
+      };
+    }
 
-    if (!rateLimitResult.allowed) {
+    // Reject private/internal input outright (SSRF)
+    if (!ALLOW_PRIVATE_IPS && isPrivateHost(new URL(url).hostname)) {
       return {
-        statusCode: 429,
-        headers: {
-          "content-type": "application/json",
-          "retry-after": Math.ceil((rateLimitResult.resetTime! - Date.now()) / 1000).toString()
-        } as Record<string, string>,
+        statusCode: 400,
+        headers: { "content-type": "application/json" } as Record<string, string>,
         body: JSON.stringify({
           ok: false,
-          error: "Rate limit exceeded",
-          resetTime: rateLimitResult.resetTime
+          error: "Resolution of private addresses is not allowed",
+          blocked: explainBlock(new URL(url).hostname)
         })
       };
     }
 
-    const { url } = JSON.parse(event.body || "{}");
+    // The domain printed next to the code, when the client read one; a
+    // mismatch with the destination suggests a sticker over the real code.
+    const claimedDomain = typeof body.claimed_domain === "string" ? normalizeClaimedDomain(body.claimed_domain) : null;
+    if (body.claimed_domain !== undefined && !claimedDomain) {
+      return {
+        statusCode: 400,
+        headers: { "content-type": "application/json" } as Record<string, string>,
+        body: JSON.stringify({ ok: false, error: "claimed_domain must be a domain name" })
+      };
+    }
 
-    // Input validation
-    if (!url || typeof url !== "string" || !isHttpUrl(url) || url.length > 2048) {
+    // Cloaking kits show scanners a harmless page; presenting as a phone
+    // browser shows what a victim would actually get.
+    const client = clientProfile(body, UA);
+    if ("error" in client) {
       return {
         statusCode: 400,
         headers: { "content-type": "application/json" } as Record<string, string>,
-        body: JSON.stringify({ ok: false, error: "Invalid URL format or length" })
+        body: JSON.stringify({ ok: false, error: client.error })
       };
     }
 
-    // Reject private/internal input outright (SSRF)
-    if (isPrivateHost(new URL(url).hostname)) {
+    const rawMax = event.queryStringParameters?.max;
+    const maxHops = rawMax === undefined ? MAX_HOPS : parseMaxHops(rawMax);
+    if (maxHops === null) {
       return {
         statusCode: 400,
         headers: { "content-type": "application/json" } as Record<string, string>,
-        body: JSON.stringify({ ok: false, error: "Resolution of private addresses is not allowed" })
+        body: JSON.stringify({ ok: false, error: "max must be a positive integer" })
       };
     }
 
-    const { resolvedUrl, hops, partial, reason } = await followRedirectChain(url);
+    // ?raw=true adds each verbatim Location header, so cloaking tricks
+    // (odd casing, encoded characters, relative paths) stay visible.
+    const rawLocations = event.queryStringParameters?.raw === "true";
+    // ?cookies=true lets gated chains complete; off by default because it
+    // means replaying a destination's session cookie back to it.
+    const cookies = event.queryStringParameters?.cookies === "true";
+    // ?headers=true adds a whitelisted set of response headers per hop, for
+    // fingerprinting the infrastructure behind a chain.
+    const responseHeaders = event.queryStringParameters?.headers === "true";
+    const chain = await followRedirectChain(url, { maxHops, rawLocations, cookies, responseHeaders, client: client.profile });
+    const { resolvedUrl, partial, reason } = chain;
+    // ?dedupe=true tidies the displayed chain; raw_hops keeps the exact sequence.
+    const dedupe = event.queryStringParameters?.dedupe === "true";
+    const { hops, details } = dedupe ? dedupeHops(chain.hops, chain.details) : chain;
+    const shortener = detectShortener(new URL(url).hostname);
+    const homograph = detectHomograph(new URL(resolvedUrl).hostname);
+    // A blocked final hop is never contacted, not even for a TLS handshake,
+    // and its DNS is not reported: the addresses and PTR names the platform's
+    // resolver holds for it are exactly the internal detail the guard protects.
+    const [dns, tls] = await Promise.all([
+      reason === "blocked"
+        ? { addresses: [], ptr: [] }
+        : lookupDns(new URL(resolvedUrl).hostname, undefined, isPrivateAddress),
+      reason === "blocked" ? {} : fetchTlsInfo(resolvedUrl, ssrfLookup)
+    ]);
+    const geoAddress = geoTarget(dns.addresses, reason);
+    const geo = geoAddress ? await fetchGeoIP(geoAddress) : null;
+    // First hop (input included) that hides its real target in a data:
+    // payload or a base64 query parameter, e.g. trusted.example/out?url=aHR0c...
+    let decodedRedirect: (EmbeddedRedirect & { hop: number }) | null = null;
+    for (const [hop, hopUrl] of hops.entries()) {
+      const embedded = findEmbeddedRedirect(hopUrl);
+      if (embedded) {
+        decodedRedirect = { hop, ...embedded };
+        break;
+      }
+    }
 
     return {
       statusCode: 200,
@@ -443,9 +787,26 @@ export const handler: Handler = async (event) => {
         ok: true,
         analysis: {
           input_url: url,
+          shortened: shortener !== null,
+          shortener,
           redirect_chain: hops,
+          hop_details: details,
+          ...(dedupe ? { raw_hops: chain.hops } : {}),
           resolved_url: resolvedUrl,
+          // What a "regenerate clean QR" action should encode; only offered
+          // when the chain actually reached its destination.
+          canonical_url: partial ? null : canonicalUrl(resolvedUrl),
           hop_count: hops.length,
+          client_profile: client.profile,
+          homograph,
+          brand_impersonation: detectBrandImpersonation(new URL(resolvedUrl).hostname),
+          ...(claimedDomain ? { claim_mismatch: checkClaimedDomain(claimedDomain, new URL(resolvedUrl).hostname) } : {}),
+          dns,
+          tls,
+          geo,
+          decoded_redirect: decodedRedirect,
+          open_redirect_abused: findOpenRedirect(hops),
+          max_hops: maxHops,
           partial,
           ...(reason ? { reason } : {})
         }
@@ -465,4 +826,4 @@ export const handler: Handler = async (event) => {
       })
     };
   }
-};
+})))));
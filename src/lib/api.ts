@@ -9,7 +9,7 @@ const KNOWN_SHORTENERS = ['bit.ly', 'tinyurl.com', 't.co', 'qrco.de', 'buff.ly',
 const RESOLVE_TIMEOUT_MS = 12_000; // server itself deadlines at 10s
 const INTEL_TIMEOUT_MS = 6_500;
 const DOMAIN_AGE_TIMEOUT_MS = 6_500;
-const THREAT_INTEL_TIMEOUT_MS = 8_000; // server-side GSB/AbuseIPDB calls timeout at 6s
+const THREAT_INTEL_TIMEOUT_MS = 8_000; // server-side GSB/AbuseIPDB/VirusTotal calls timeout at 6s
 
 async function fetchWithTimeout(input: string, init: RequestInit, timeoutMs: number): Promise<Response> {
   const controller = new AbortController();
@@ -33,9 +33,57 @@ export interface ResolveAnalysisResponse {
   ok: boolean;
   analysis?: {
     input_url: string;
+    shortened?: boolean;
+    shortener?: string | null;
     redirect_chain: string[];
+    /** Every hop as followed, before collapsing near-duplicates (resolve ?dedupe=true only). */
+    raw_hops?: string[];
+    hop_details?: Array<{
+      url: string;
+      status: number | null;
+      method: 'HEAD' | 'GET' | null;
+      /** Why the SSRF guard refused the hop, and the address it refused. */
+      blocked?: { reason: 'private_ip' | 'loopback' | 'link_local' | 'metadata_endpoint'; ip: string | null };
+      location_raw?: string;
+      location_resolved?: string;
+      /** Whitelisted response headers (resolve ?headers=true only). */
+      headers?: Record<string, string>;
+      /** Names of cookies the hop set; values are redacted. */
+      set_cookie?: string[];
+    }>;
     resolved_url: string;
+    /** resolved_url minus tracking parameters, for a "regenerate clean QR" action; null when partial. */
+    canonical_url?: string | null;
     hop_count: number;
+    /** Browser the resolver presented as: a preset, 'custom', or 'default' (its own UA). */
+    client_profile?: { name: string; user_agent: string; accept_language: string | null; mobile: boolean };
+    homograph?: { ascii: string; unicode: string; punycode: boolean; homograph_suspected: boolean };
+    /** Watchlisted brand the final host imitates, with its edit distance (0 = the name itself). */
+    brand_impersonation?: { brand: string; distance: number } | null;
+    /** Sent only with claimed_domain: set when the destination is not the domain the context showed. */
+    claim_mismatch?: { claimed: string; actual: string } | null;
+    dns?: { addresses: string[]; ptr: string[] };
+    /** Certificate of an https final URL; empty for http or a failed handshake. */
+    tls?: {
+      subject?: string | null;
+      issuer?: string | null;
+      valid_from?: string | null;
+      valid_to?: string | null;
+      san?: string[];
+      self_signed?: boolean;
+      expired?: boolean;
+      hostname_mismatch?: boolean;
+    };
+    /** Location of the first final-host address; null when the host did not resolve. */
+    geo?:
+      | { configured: false }
+      | { configured: true; ip: string; country?: string | null; region?: string | null; asn?: string | null; org?: string | null; error?: string }
+      | null;
+    /** Target hidden in a data: payload or base64 query parameter of hop `hop`. */
+    decoded_redirect?: { hop: number; source: 'data_url' | 'query_param'; param?: string; url: string } | null;
+    /** Hop whose query parameter (e.g. ?url=) the chain followed to another host. */
+    open_redirect_abused?: { hop: number; param: string; target: string } | null;
+    max_hops?: number;
     partial?: boolean;
     reason?: string;
   };
@@ -48,6 +96,15 @@ export interface IntelResponse {
     source: string;
     query_status: string;
     matches: unknown[];
+    /** Whether the listed URLs still serve malware; offline is a weaker signal than online. */
+    url_status?: 'online' | 'offline' | 'unknown';
+    /** Host-level listing; url_count > 0 means the host has served malware before. */
+    urlhaus_host?: { query_status: string; url_count: number; blacklists: Record<string, string>; error?: string } | null;
+    warning?: string;
+    /** Set when a deployment deny/allow list answered instead of URLHaus. */
+    verdict?: 'blocked' | 'trusted';
+    /** Upstream failure detail: timeout, DNS/connection code, or HTTP status. */
+    error?: string;
   } | null;
 }
 
@@ -262,7 +319,11 @@ export async function intel(url: string): Promise<IntelResponse> {
  */
 export interface DomainAgeResult {
   age_days: number | null;
+  registered_at?: string | null;
+  suspicious_new?: boolean;
   risk_points: number;
+  /** Stable reason code for `message` (e.g. DOMAIN_VERY_NEW); safe to localize on. */
+  code?: string;
   message: string;
 }
 
@@ -273,8 +334,32 @@ export interface ThreatIntelResult {
   threat_detected: boolean;
   risk_points: number;
   message: string;
-  threats: Array<{ source: string; details: string; score: number }>;
+  /** Stable reason code for `message` (e.g. THREAT_HIGH); safe to localize on. */
+  code?: string;
+  threats: Array<{ source: string; code?: string; details: string; score: number }>;
   sources_checked: string[];
+  /** Per-feed outcome; a feed that is not `ok` did not vouch for the URL. */
+  sources?: Array<{ name: string; status: 'ok' | 'no_report' | 'error' | 'not_configured' | 'timeout' | 'throttled' | 'unavailable' }>;
+  /** VirusTotal engine counts for the URL; null when VT has no report. */
+  virustotal?: {
+    malicious: number;
+    suspicious: number;
+    harmless: number;
+    undetected: number;
+    permalink: string;
+  } | null;
+  /** ThreatFox IOCs for the destination host; empty when none, null when not consulted. */
+  threatfox?: Array<{
+    ioc: string;
+    ioc_type: string;
+    threat_type: string;
+    malware: string;
+    confidence_level: number;
+    first_seen: string | null;
+    last_seen: string | null;
+  }> | null;
+  /** Set when a deployment deny/allow list decided the result and no feed was asked. */
+  verdict?: 'blocked' | 'trusted';
 }
 
 /**
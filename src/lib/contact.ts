@@ -0,0 +1,142 @@
+/**
+ * Contact-card payloads: vCard (BEGIN:VCARD ... END:VCARD) and the compact
+ * MECARD format phone cameras also produce. Both are parsed leniently — a
+ * truncated or hand-edited card yields whatever fields could be read rather
+ * than an error, since the point is to show the user what they would save.
+ */
+
+export interface ContactCard {
+  format: 'vcard' | 'mecard';
+  /** Display name: FN, else the structured N fields. */
+  name?: string;
+  firstName?: string;
+  lastName?: string;
+  organization?: string;
+  phones: string[];
+  emails: string[];
+  /** http(s) links from URL fields, scheme added when the card left it off. */
+  urls: string[];
+}
+
+export function isContactPayload(data: string): boolean {
+  return /^(BEGIN:VCARD|MECARD:)/i.test(data.trim());
+}
+
+/** Normalize a URL field to an absolute http(s) URL, or null when it isn't one. */
+function toHttpUrl(value: string): string | null {
+  const candidate = /^[a-z][a-z0-9+.-]*:/i.test(value) ? value : `https://${value}`;
+  try {
+    const parsed = new URL(candidate);
+    if (parsed.protocol !== 'http:' && parsed.protocol !== 'https:') return null;
+    if (!parsed.hostname.includes('.')) return null;
+    return candidate;
+  } catch {
+    return null;
+  }
+}
+
+/**
+ * Split on `sep` except where it is backslash-escaped. MECARD and WIFI:
+ * payloads share this field syntax.
+ */
+export function splitUnescaped(text: string, sep: string): string[] {
+  const parts: string[] = [];
+  let current = '';
+  for (let i = 0; i < text.length; i++) {
+    const ch = text[i];
+    if (ch === '\\' && i + 1 < text.length) {
+      current += ch + text[i + 1];
+      i++;
+    } else if (ch === sep) {
+      parts.push(current);
+      current = '';
+    } else {
+      current += ch;
+    }
+  }
+  parts.push(current);
+  return parts;
+}
+
+/** Drop backslash escapes (\n becomes a newline) and trim. */
+export function unescapeValue(value: string): string {
+  return value.replace(/\\(.)/g, (_, ch: string) => (ch === 'n' || ch === 'N' ? '\n' : ch)).trim();
+}
+
+function emptyCard(format: ContactCard['format']): ContactCard {
+  return { format, phones: [], emails: [], urls: [] };
+}
+
+function addField(card: ContactCard, key: string, value: string) {
+  if (!value) return;
+  switch (key) {
+    case 'TEL':
+      card.phones.push(value);
+      break;
+    case 'EMAIL':
+      card.emails.push(value);
+      break;
+    case 'URL': {
+      const url = toHttpUrl(value);
+      if (url && !card.urls.includes(url)) card.urls.push(url);
+      break;
+    }
+    case 'ORG':
+      card.organization ??= value;
+      break;
+  }
+}
+
+function parseVcard(data: string): ContactCard {
+  const card = emptyCard('vcard');
+  // Folded lines continue with a leading space or tab
+  const lines = data.replace(/\r?\n[ \t]/g, '').split(/\r?\n/);
+  for (const line of lines) {
+    const colon = line.indexOf(':');
+    if (colon <= 0) continue;
+    // "item1.TEL;TYPE=cell" -> TEL
+    const key = line.slice(0, colon).split(';')[0].split('.').pop()!.toUpperCase();
+    const raw = line.slice(colon + 1);
+    if (key === 'FN') {
+      card.name ??= unescapeValue(raw) || undefined;
+    } else if (key === 'N') {
+      const [last, first] = splitUnescaped(raw, ';').map(unescapeValue);
+      card.lastName ??= last || undefined;
+      card.firstName ??= first || undefined;
+    } else if (key === 'ORG') {
+      addField(card, key, splitUnescaped(raw, ';').map(unescapeValue).filter(Boolean).join(', '));
+    } else {
+      addField(card, key, unescapeValue(raw));
+    }
+  }
+  return card;
+}
+
+function parseMecard(data: string): ContactCard {
+  const card = emptyCard('mecard');
+  for (const field of splitUnescaped(data.trim().replace(/^MECARD:/i, ''), ';')) {
+    const colon = field.indexOf(':');
+    if (colon <= 0) continue;
+    const key = field.slice(0, colon).toUpperCase();
+    const raw = field.slice(colon + 1);
+    if (key === 'N') {
+      // "Last,First"
+      const [last, first] = splitUnescaped(raw, ',').map(unescapeValue);
+      card.lastName ??= last || undefined;
+      card.firstName ??= first || undefined;
+    } else {
+      addField(card, key, unescapeValue(raw));
+    }
+  }
+  return card;
+}
+
+/** Parse a vCard or MECARD payload; fields that can't be read are left empty. */
+export function parseContact(data: string): ContactCard {
+  const card = /^MECARD:/i.test(data.trim()) ? parseMecard(data) : parseVcard(data);
+  if (!card.name) {
+    const joined = [card.firstName, card.lastName].filter(Boolean).join(' ');
+    card.name = joined || undefined;
+  }
+  return card;
+}
@@ -1,3 +1,6 @@
+import { isContactPayload, parseContact, type ContactCard } from './contact';
+import { isWifiPayload, parseWifi, type WifiNetwork } from './wifi';
+
 // jsqr is ~252 KB — the bulk of the bundle — but only needed when an image is
 // actually scanned, not when pasting a URL. It's dynamic-imported on first use.
 type JsQR = typeof import('jsqr').default;
@@ -36,6 +39,10 @@ export interface QRContent {
     latitude?: number;
     longitude?: number;
   };
+  /** Structured fields of a vCard or MECARD payload. */
+  contact?: ContactCard;
+  /** Structured fields of a WIFI: payload. */
+  wifi?: WifiNetwork;
 }
 
 /**
@@ -510,43 +517,36 @@ export function parseQRContent(data: string): QRContent {
   }
   
   // Check for WiFi
-  if (trimmedData.startsWith('WIFI:')) {
-    const wifiRegex = /^WIFI:(T:([^;]+);)?(S:([^;]+);)?(P:([^;]+);)?/;
-    const match = wifiRegex.exec(trimmedData);
+  if (isWifiPayload(trimmedData)) {
+    const wifi = parseWifi(trimmedData);
 
-    if (match) {
-      return {
-        type: 'wifi',
-        text: match[4] || 'Unknown Network',
-        raw: data,
-        metadata: {
-          ssid: match[4],
-          password: match[6],
-          encryption: match[2] || 'nopass'
-        }
-      };
-    }
+    return {
+      type: 'wifi',
+      text: wifi.ssid || 'Unknown Network',
+      raw: data,
+      metadata: {
+        ssid: wifi.ssid || undefined,
+        password: wifi.password,
+        encryption: wifi.authType
+      },
+      wifi
+    };
   }
   
-  // Check for vCard
-  if (trimmedData.startsWith('BEGIN:VCARD')) {
-    const firstNameRegex = /FN:(.+)/;
-    const lastNameRegex = /LN:(.+)/;
-    const emailRegex = /EMAIL:(.+)/;
-    
-    const firstNameMatch = firstNameRegex.exec(trimmedData);
-    const lastNameMatch = lastNameRegex.exec(trimmedData);
-    const emailMatch = emailRegex.exec(trimmedData);
-    
+  // Check for vCard / MECARD
+  if (isContactPayload(trimmedData)) {
+    const contact = parseContact(trimmedData);
+
     return {
       type: 'vcard',
-      text: firstNameMatch ? firstNameMatch[1] : 'Contact',
+      text: contact.name || 'Contact',
       raw: data,
       metadata: {
-        firstName: firstNameMatch ? firstNameMatch[1] : undefined,
-        lastName: lastNameMatch ? lastNameMatch[1] : undefined,
-        email: emailMatch ? emailMatch[1] : undefined
-      }
+        firstName: contact.firstName,
+        lastName: contact.lastName,
+        email: contact.emails[0]
+      },
+      contact
     };
   }
   
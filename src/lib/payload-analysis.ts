@@ -150,19 +150,30 @@ function analyzeWifi(content: QRContent, analysis: PayloadAnalysis) {
     });
   }
 
+  if (content.wifi?.hidden) {
+    analysis.checks.push({
+      id: 'wifi-hidden',
+      label: 'Hidden network',
+      status: 'info',
+      detail: 'The network name is not broadcast — a device that saves it keeps calling out for it everywhere'
+    });
+  }
+
   analysis.recommendations.push('Verify the network name with the venue before joining — rogue hotspots imitate legitimate ones.');
 }
 
 function analyzeVcard(content: QRContent, analysis: PayloadAnalysis) {
-  const name = content.metadata?.firstName || content.text || 'Contact';
+  const name = content.contact?.name || content.metadata?.firstName || content.text || 'Contact';
+  const organization = content.contact?.organization;
   analysis.checks.push({
     id: 'vcard-name',
     label: 'Contact card',
     status: 'info',
-    detail: `Contact: ${name}`
+    detail: `Contact: ${name}${organization ? ` (${organization})` : ''}`
   });
 
-  const urls = extractUrls(content.raw);
+  // URL fields can be scheme-less or MECARD-escaped, so the raw text alone misses them
+  const urls = Array.from(new Set([...extractUrls(content.raw), ...(content.contact?.urls ?? [])]));
   if (urls.length > 0) {
     analysis.checks.push({
       id: 'vcard-link',
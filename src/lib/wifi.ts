@@ -0,0 +1,45 @@
+/**
+ * WIFI: network payloads (WIFI:T:WPA;S:name;P:secret;H:true;;). Scanning one
+ * on most phones offers to join the network, so the fields are surfaced for
+ * review first. The password is kept for display only and must never be
+ * logged or sent anywhere.
+ */
+
+import { splitUnescaped } from './contact';
+
+export interface WifiNetwork {
+  ssid: string;
+  /** Upper-cased T field (WPA, WEP, SAE...), "NOPASS" when absent or empty. */
+  authType: string;
+  password?: string;
+  /** H:true — the network doesn't broadcast its name. */
+  hidden: boolean;
+  /** True when joining needs no key, so traffic is unencrypted. */
+  open: boolean;
+}
+
+export function isWifiPayload(data: string): boolean {
+  return /^WIFI:/i.test(data.trim());
+}
+
+/** Parse a WIFI: payload. Fields may come in any order; unknown ones are ignored. */
+export function parseWifi(data: string): WifiNetwork {
+  const fields: Record<string, string> = {};
+  for (const field of splitUnescaped(data.trim().replace(/^WIFI:/i, ''), ';')) {
+    const colon = field.indexOf(':');
+    if (colon <= 0) continue;
+    const key = field.slice(0, colon).toUpperCase();
+    // Not trimmed: spaces can be part of an SSID or password. First
+    // occurrence wins, as most readers do.
+    fields[key] ??= field.slice(colon + 1).replace(/\\(.)/g, '$1');
+  }
+
+  const authType = (fields.T || 'nopass').toUpperCase();
+  return {
+    ssid: fields.S ?? '',
+    authType,
+    password: fields.P || undefined,
+    hidden: fields.H?.toLowerCase() === 'true',
+    open: authType === 'NOPASS'
+  };
+}
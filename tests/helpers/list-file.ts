@@ -0,0 +1,10 @@
+import { mkdtempSync, writeFileSync } from 'node:fs';
+import { tmpdir } from 'node:os';
+import { join } from 'node:path';
+
+/** Write a domain list to a fresh temp file, for DENYLIST_FILE / ALLOWLIST_FILE. */
+export function listFile(contents: string): string {
+  const path = join(mkdtempSync(join(tmpdir(), 'qrcheck-lists-')), 'list.txt');
+  writeFileSync(path, contents);
+  return path;
+}
@@ -0,0 +1,44 @@
+import { describe, it, expect } from 'vitest';
+import { BodyTooLargeError, readCappedJson, readCappedText } from '../../functions/lib/body';
+
+/** A body streamed in chunks with no Content-Length, like a chunked upstream. */
+function streamed(chunks: string[]): Response {
+  const encoder = new TextEncoder();
+  let cancelled = false;
+  const stream = new ReadableStream<Uint8Array>({
+    pull(controller) {
+      const next = chunks.shift();
+      if (next === undefined) controller.close();
+      else controller.enqueue(encoder.encode(next));
+    },
+    cancel() {
+      cancelled = true;
+    }
+  });
+  const res = new Response(stream);
+  Object.defineProperty(res, 'cancelled', { get: () => cancelled });
+  return res;
+}
+
+describe('readCappedText', () => {
+  it('reads a body under the limit', async () => {
+    expect(await readCappedText(new Response('hello'), 16)).toBe('hello');
+    expect(await readCappedJson(Response.json({ ok: true }), 64)).toEqual({ ok: true });
+  });
+
+  it('rejects an oversized Content-Length before reading', async () => {
+    const res = new Response('x'.repeat(32), { headers: { 'content-length': '32' } });
+    await expect(readCappedText(res, 16)).rejects.toBeInstanceOf(BodyTooLargeError);
+  });
+
+  it('stops a streamed body as soon as it passes the limit', async () => {
+    const res = streamed(['aaaaaaaa', 'bbbbbbbb', 'cccccccc', 'dddddddd']);
+    await expect(readCappedText(res, 12)).rejects.toThrow('exceeded 12 bytes');
+    expect((res as unknown as { cancelled: boolean }).cancelled).toBe(true);
+  });
+
+  it('counts bytes, not characters', async () => {
+    await expect(readCappedText(new Response('ééé'), 5)).rejects.toBeInstanceOf(BodyTooLargeError);
+    expect(await readCappedText(new Response('ééé'), 6)).toBe('ééé');
+  });
+});
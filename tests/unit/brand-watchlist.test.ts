@@ -0,0 +1,49 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { detectBrandImpersonation } from '../../functions/lib/brand-watchlist';
+
+const brands = ['paypal.com', 'acme.example'];
+
+afterEach(() => {
+  vi.unstubAllEnvs();
+  vi.resetModules();
+});
+
+describe('detectBrandImpersonation', () => {
+  it.each([
+    ['paypai.com', { brand: 'paypal.com', distance: 1 }],
+    ['paypa11.com', { brand: 'paypal.com', distance: 2 }],
+    ['paypal-secure.com', { brand: 'paypal.com', distance: 0 }],
+    ['paypal.com.evil.example', { brand: 'paypal.com', distance: 0 }],
+    // pаypal.com with a Cyrillic "а"
+    ['xn--pypal-4ve.com', { brand: 'paypal.com', distance: 0 }],
+    ['acme.shop', { brand: 'acme.example', distance: 0 }]
+  ])('flags %s', (host, expected) => {
+    expect(detectBrandImpersonation(host, brands, 2)).toEqual(expected);
+  });
+
+  it.each([
+    'paypal.com',
+    'www.paypal.com',
+    'PayPal.com.',
+    'google.com',
+    // Short names only match exactly
+    'acne.example',
+    '203.0.113.5'
+  ])('leaves %s alone', (host) => {
+    expect(detectBrandImpersonation(host, brands, 2)).toBeNull();
+  });
+
+  it('honours the distance threshold', () => {
+    expect(detectBrandImpersonation('paypa11.com', brands, 1)).toBeNull();
+  });
+
+  it('reads the watchlist and threshold from the environment', async () => {
+    vi.stubEnv('BRAND_WATCHLIST', 'Contoso.com');
+    vi.stubEnv('BRAND_MAX_DISTANCE', '1');
+    vi.resetModules();
+    const { detectBrandImpersonation: detect } = await import('../../functions/lib/brand-watchlist');
+
+    expect(detect('c0ntoso.com')).toEqual({ brand: 'contoso.com', distance: 1 });
+    expect(detect('c0nt0so.com')).toBeNull();
+  });
+});
@@ -0,0 +1,59 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { canonicalUrl } from '../../functions/lib/canonical-url';
+
+describe('canonicalUrl', () => {
+  it('drops tracking parameters and keeps the rest in order', () => {
+    expect(canonicalUrl('https://shop.example/item?utm_source=qr&id=42&fbclid=abc&utm_campaign=spring&color=red'))
+      .toBe('https://shop.example/item?id=42&color=red');
+  });
+
+  it('removes the query entirely when only trackers were present', () => {
+    expect(canonicalUrl('https://shop.example/?utm_medium=print&gclid=1')).toBe('https://shop.example/');
+  });
+
+  it('normalizes host and port but leaves path, encoding and fragment alone', () => {
+    expect(canonicalUrl('https://Shop.Example:443/a%20b/?q=a+b&name=J%C3%BCrgen&mc_eid=9#reviews'))
+      .toBe('https://shop.example/a%20b/?q=a+b&name=J%C3%BCrgen#reviews');
+  });
+
+  it('matches tracker names case-insensitively, including encoded names', () => {
+    expect(canonicalUrl('https://shop.example/?UTM_Source=x&%75tm_term=y&keep=1')).toBe('https://shop.example/?keep=1');
+  });
+
+  it('returns null for unparseable input', () => {
+    expect(canonicalUrl('not a url')).toBeNull();
+  });
+
+  it('takes exact names and trailing-* prefixes from a custom list', () => {
+    expect(canonicalUrl('https://shop.example/?ref=qr&ref_src=x&refund=1&cmp_a=1&id=7', ['ref', 'cmp_*']))
+      .toBe('https://shop.example/?ref_src=x&refund=1&id=7');
+  });
+
+  it('never touches a path that looks like a tracker', () => {
+    expect(canonicalUrl('https://shop.example/utm_source/fbclid?fbclid=1')).toBe('https://shop.example/utm_source/fbclid');
+  });
+});
+
+describe('STRIP_PARAMS', () => {
+  afterEach(() => {
+    vi.unstubAllEnvs();
+    vi.resetModules();
+  });
+
+  it('replaces the built-in tracker list when set', async () => {
+    vi.stubEnv('STRIP_PARAMS', ' fbclid , ref_* ');
+    vi.resetModules();
+    const { canonicalUrl: configured } = await import('../../functions/lib/canonical-url');
+
+    expect(configured('https://shop.example/?utm_source=qr&ref_id=2&fbclid=3'))
+      .toBe('https://shop.example/?utm_source=qr');
+  });
+
+  it('defaults to the built-in tracker list', async () => {
+    vi.stubEnv('STRIP_PARAMS', '');
+    vi.resetModules();
+    const { STRIP_PARAMS, TRACKING_PARAMS } = await import('../../functions/lib/canonical-url');
+
+    expect(STRIP_PARAMS).toBe(TRACKING_PARAMS);
+  });
+});
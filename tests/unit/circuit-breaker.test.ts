@@ -0,0 +1,82 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { CircuitBreaker } from '../../functions/lib/circuit-breaker';
+
+afterEach(() => {
+  vi.restoreAllMocks();
+});
+
+describe('CircuitBreaker', () => {
+  it('opens after the threshold of consecutive failures', () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const breaker = new CircuitBreaker('feed', 3, 1_000);
+
+    breaker.failure(0);
+    breaker.failure(0);
+    expect(breaker.allow(0)).toBe(true);
+    breaker.failure(0);
+
+    expect(breaker.state(0)).toBe('open');
+    expect(breaker.allow(500)).toBe(false);
+    expect(breaker.retryAt()).toBe(1_000);
+  });
+
+  it('counts only consecutive failures', () => {
+    const breaker = new CircuitBreaker('feed', 2, 1_000);
+
+    breaker.failure(0);
+    breaker.success();
+    breaker.failure(0);
+
+    expect(breaker.state(0)).toBe('closed');
+  });
+
+  it('lets one probe through after the cooldown and closes on success', () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    vi.spyOn(console, 'log').mockImplementation(() => {});
+    const breaker = new CircuitBreaker('feed', 1, 1_000);
+    breaker.failure(0);
+
+    expect(breaker.state(1_000)).toBe('half_open');
+    expect(breaker.allow(1_000)).toBe(true);
+    expect(breaker.allow(1_000)).toBe(false);
+
+    breaker.success();
+    expect(breaker.state(1_000)).toBe('closed');
+    expect(breaker.retryAt()).toBeNull();
+  });
+
+  it('reopens for another cooldown when the probe fails', () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const breaker = new CircuitBreaker('feed', 1, 1_000);
+    breaker.failure(0);
+
+    expect(breaker.allow(1_500)).toBe(true);
+    breaker.failure(1_500);
+
+    expect(breaker.allow(2_000)).toBe(false);
+    expect(breaker.retryAt()).toBe(2_500);
+  });
+
+  it('records the outcome of run()', async () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const breaker = new CircuitBreaker('feed', 1, 60_000);
+
+    await expect(breaker.run(async () => 'ok')).resolves.toBe('ok');
+    await expect(breaker.run(async () => { throw new Error('down'); })).rejects.toThrow('down');
+
+    expect(breaker.state()).toBe('open');
+  });
+
+  it('hands a released probe to the next caller', () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const breaker = new CircuitBreaker('feed', 1, 1_000);
+    breaker.failure(0);
+    expect(breaker.allow(500)).toBe(false);
+
+    expect(breaker.allow(1_000)).toBe(true);
+    breaker.release();
+
+    expect(breaker.state(1_000)).toBe('half_open');
+    expect(breaker.allow(1_000)).toBe(true);
+  });
+});
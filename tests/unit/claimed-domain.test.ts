@@ -0,0 +1,36 @@
+import { describe, it, expect } from 'vitest';
+import { checkClaimedDomain, normalizeClaimedDomain } from '../../functions/lib/claimed-domain';
+
+describe('normalizeClaimedDomain', () => {
+  it.each([
+    ['Apple.com', 'apple.com'],
+    ['  https://www.apple.com/support ', 'www.apple.com'],
+    ['apple.com.', 'apple.com'],
+    ['bücher.example', 'xn--bcher-kva.example']
+  ])('%j -> %s', (raw, expected) => {
+    expect(normalizeClaimedDomain(raw)).toBe(expected);
+  });
+
+  it.each(['', 'apple', 'not a domain', 'user@apple.com'])('rejects %j', (raw) => {
+    expect(normalizeClaimedDomain(raw)).toBeNull();
+  });
+});
+
+describe('checkClaimedDomain', () => {
+  it.each([
+    ['apple.com', 'apple.com'],
+    ['apple.com', 'support.apple.com'],
+    ['www.apple.com', 'apple.com'],
+    ['apple.com', 'WWW.Apple.com.']
+  ])('accepts %s leading to %s', (claimed, host) => {
+    expect(checkClaimedDomain(claimed, host)).toBeNull();
+  });
+
+  it.each([
+    ['apple.com', 'apple-verify.ru'],
+    ['apple.com', 'apple.com.evil.example'],
+    ['support.apple.com', 'apple.com']
+  ])('flags %s leading to %s', (claimed, host) => {
+    expect(checkClaimedDomain(claimed, host)).toEqual({ claimed, actual: host });
+  });
+});
@@ -0,0 +1,65 @@
+import { describe, it, expect } from 'vitest';
+import { CLIENT_PROFILES, clientHeaders, clientProfile } from '../../functions/lib/client-profile';
+
+const UA = 'QRCheck-LinkResolver/1.0 (+https://qrcheck.ca)';
+
+describe('clientProfile', () => {
+  it('keeps the resolver identity when nothing is asked for', () => {
+    expect(clientProfile({}, UA)).toEqual({
+      profile: { name: 'default', user_agent: UA, accept_language: null, mobile: false }
+    });
+  });
+
+  it('uses a preset as-is', () => {
+    expect(clientProfile({ profile: 'mobile-ios' }, UA)).toEqual({
+      profile: { name: 'mobile-ios', ...CLIENT_PROFILES['mobile-ios'] }
+    });
+  });
+
+  it('applies overrides on top of a preset', () => {
+    const result = clientProfile({ profile: 'mobile-android', accept_language: 'fr-CA,fr;q=0.8' }, UA);
+
+    expect(result).toEqual({
+      profile: { name: 'mobile-android', ...CLIENT_PROFILES['mobile-android'], accept_language: 'fr-CA,fr;q=0.8' }
+    });
+  });
+
+  it('names overrides without a preset "custom"', () => {
+    const result = clientProfile({ user_agent: ' Mozilla/5.0 Test ', mobile: true }, UA);
+
+    expect(result).toEqual({
+      profile: { name: 'custom', user_agent: 'Mozilla/5.0 Test', accept_language: null, mobile: true }
+    });
+  });
+
+  it.each([
+    [{ profile: 'smart-fridge' }, 'profile must be one of mobile-ios, mobile-android, desktop'],
+    [{ profile: 'toString' }, 'profile must be one of mobile-ios, mobile-android, desktop'],
+    [{ user_agent: 'Mozilla/5.0\r\nX-Injected: 1' }, 'user_agent must be a single line of at most 512 characters'],
+    [{ user_agent: 'a'.repeat(513) }, 'user_agent must be a single line of at most 512 characters'],
+    [{ accept_language: 'en\nx' }, 'accept_language must be an Accept-Language value, e.g. en-US,en;q=0.9'],
+    [{ mobile: 'yes' }, 'mobile must be a boolean']
+  ])('rejects %j', (overrides, error) => {
+    expect(clientProfile(overrides, UA)).toEqual({ error });
+  });
+});
+
+describe('clientHeaders', () => {
+  it('sends only the User-Agent for the default profile', () => {
+    const result = clientProfile({}, UA);
+    if ('error' in result) throw new Error(result.error);
+
+    expect(clientHeaders(result.profile)).toEqual({ 'user-agent': UA });
+  });
+
+  it('adds Accept-Language and the mobile client hint for a preset', () => {
+    const result = clientProfile({ profile: 'mobile-android' }, UA);
+    if ('error' in result) throw new Error(result.error);
+
+    expect(clientHeaders(result.profile)).toEqual({
+      'user-agent': CLIENT_PROFILES['mobile-android'].user_agent,
+      'accept-language': 'en-US,en;q=0.9',
+      'sec-ch-ua-mobile': '?1'
+    });
+  });
+});
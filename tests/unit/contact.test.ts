@@ -0,0 +1,68 @@
+import { describe, it, expect } from 'vitest';
+import { parseContact } from '../../src/lib/contact';
+import { parseQRContent } from '../../src/lib/decode';
+
+describe('parseContact', () => {
+  it('extracts vCard fields, including grouped and folded lines', () => {
+    const card = parseContact([
+      'BEGIN:VCARD',
+      'VERSION:3.0',
+      'N:Doe;Jane;;;',
+      'FN:Jane Doe',
+      'ORG:Acme;Sales',
+      'item1.TEL;TYPE=cell:+1 555 0100',
+      'TEL;TYPE=work:+1 555 0101',
+      'EMAIL;TYPE=internet:jane@acme.example',
+      'URL:https://acme.example/',
+      ' team',
+      'END:VCARD'
+    ].join('\r\n'));
+
+    expect(card).toEqual({
+      format: 'vcard',
+      name: 'Jane Doe',
+      firstName: 'Jane',
+      lastName: 'Doe',
+      organization: 'Acme, Sales',
+      phones: ['+1 555 0100', '+1 555 0101'],
+      emails: ['jane@acme.example'],
+      urls: ['https://acme.example/team']
+    });
+  });
+
+  it('extracts MECARD fields and unescapes values', () => {
+    const card = parseContact('MECARD:N:Doe,John;TEL:+15550100;EMAIL:john@doe.example;ORG:Doe\\; Sons;URL:http\\://doe.example;;');
+
+    expect(card).toMatchObject({
+      format: 'mecard',
+      name: 'John Doe',
+      organization: 'Doe; Sons',
+      phones: ['+15550100'],
+      emails: ['john@doe.example'],
+      urls: ['http://doe.example']
+    });
+  });
+
+  it('adds a scheme to bare URL fields and drops non-web ones', () => {
+    const card = parseContact('MECARD:N:X;URL:www.shop.example;URL:javascript\\:alert(1);URL:localhost;;');
+
+    expect(card.urls).toEqual(['https://www.shop.example']);
+  });
+
+  it('returns what it can from a truncated card instead of failing', () => {
+    const card = parseContact('BEGIN:VCARD\nVERSION:3.0\nFN:Half\nTEL');
+
+    expect(card).toEqual({ format: 'vcard', name: 'Half', phones: [], emails: [], urls: [] });
+  });
+});
+
+describe('parseQRContent contact payloads', () => {
+  it('classifies MECARD as a contact card', () => {
+    const content = parseQRContent('MECARD:N:Doe,John;EMAIL:john@doe.example;;');
+
+    expect(content.type).toBe('vcard');
+    expect(content.text).toBe('John Doe');
+    expect(content.metadata?.email).toBe('john@doe.example');
+    expect(content.contact?.format).toBe('mecard');
+  });
+});
@@ -0,0 +1,61 @@
+import { describe, it, expect } from 'vitest';
+import { CookieJar } from '../../functions/lib/cookie-jar';
+
+describe('CookieJar', () => {
+  it('sends a host-only cookie back to the same host only', () => {
+    const jar = new CookieJar();
+    jar.store('https://a.example.com/start', ['sid=abc; Path=/; HttpOnly']);
+
+    expect(jar.header('https://a.example.com/next')).toBe('sid=abc');
+    expect(jar.header('https://b.example.com/')).toBeNull();
+  });
+
+  it('shares a Domain cookie with subdomains', () => {
+    const jar = new CookieJar();
+    jar.store('https://login.example.com/', ['gate=1; Domain=.example.com']);
+
+    expect(jar.header('https://cdn.example.com/')).toBe('gate=1');
+    expect(jar.header('https://example.com/')).toBe('gate=1');
+    expect(jar.header('https://example.org/')).toBeNull();
+  });
+
+  it('ignores cookies scoped to an unrelated domain or a bare TLD', () => {
+    const jar = new CookieJar();
+    jar.store('https://evil.example/', ['x=1; Domain=bank.example', 'y=2; Domain=example']);
+
+    expect(jar.header('https://bank.example/')).toBeNull();
+    expect(jar.header('https://evil.example/')).toBeNull();
+  });
+
+  it('keeps cookies from an IPv6 literal host on that exact host', () => {
+    const jar = new CookieJar();
+    jar.store('https://[2606:4700::1111]/', ['sid=v6; Domain=example.com']);
+
+    expect(jar.header('https://[2606:4700::1111]/next')).toBe('sid=v6');
+    expect(jar.header('https://example.com/')).toBeNull();
+  });
+
+  it('keeps Secure cookies off plain http', () => {
+    const jar = new CookieJar();
+    jar.store('https://shop.example/', ['s=1; Secure', 'p=2']);
+
+    expect(jar.header('http://shop.example/')).toBe('p=2');
+    expect(jar.header('https://shop.example/')).toBe('s=1; p=2');
+  });
+
+  it('deletes a cookie on Max-Age=0 or a past Expires', () => {
+    const jar = new CookieJar();
+    jar.store('https://shop.example/', ['a=1', 'b=2']);
+    jar.store('https://shop.example/', ['a=; Max-Age=0', 'b=; Expires=Thu, 01 Jan 1970 00:00:00 GMT']);
+
+    expect(jar.header('https://shop.example/')).toBeNull();
+  });
+
+  it('replaces a cookie when it is set again', () => {
+    const jar = new CookieJar();
+    jar.store('https://shop.example/', ['step=1']);
+    jar.store('https://shop.example/', ['step=2']);
+
+    expect(jar.header('https://shop.example/')).toBe('step=2');
+  });
+});
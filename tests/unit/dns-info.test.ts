@@ -0,0 +1,61 @@
+import { describe, it, expect, vi } from 'vitest';
+import { lookupDns, type DnsResolverLike } from '../../functions/lib/dns-info';
+
+function nxdomain(): Promise<string[]> {
+  return Promise.reject(Object.assign(new Error('queryA ENOTFOUND'), { code: 'ENOTFOUND' }));
+}
+
+function stubResolver(overrides: Partial<DnsResolverLike> = {}): DnsResolverLike {
+  return {
+    resolve4: vi.fn(async () => ['93.184.216.34']),
+    resolve6: vi.fn(async () => ['2606:2800:220:1:248:1893:25c8:1946']),
+    reverse: vi.fn(async () => ['edge.example.net']),
+    ...overrides
+  };
+}
+
+describe('lookupDns', () => {
+  it('returns A and AAAA records with the PTR of the first address', async () => {
+    const resolver = stubResolver();
+
+    const info = await lookupDns('example.com', resolver);
+
+    expect(info).toEqual({
+      addresses: ['93.184.216.34', '2606:2800:220:1:248:1893:25c8:1946'],
+      ptr: ['edge.example.net']
+    });
+    expect(resolver.reverse).toHaveBeenCalledWith('93.184.216.34');
+  });
+
+  it('returns empty lists for NXDOMAIN without throwing', async () => {
+    const resolver = stubResolver({ resolve4: nxdomain, resolve6: nxdomain });
+
+    expect(await lookupDns('does-not-exist.example', resolver)).toEqual({ addresses: [], ptr: [] });
+    expect(resolver.reverse).not.toHaveBeenCalled();
+  });
+
+  it('keeps the addresses when only the reverse lookup fails', async () => {
+    const resolver = stubResolver({ resolve6: nxdomain, reverse: nxdomain });
+
+    expect(await lookupDns('v4-only.example', resolver)).toEqual({ addresses: ['93.184.216.34'], ptr: [] });
+  });
+
+  it('skips forward lookups for IP literals', async () => {
+    const resolver = stubResolver();
+
+    const info = await lookupDns('[2001:4860:4860::8888]', resolver);
+
+    expect(info.addresses).toEqual(['2001:4860:4860::8888']);
+    expect(resolver.resolve4).not.toHaveBeenCalled();
+    expect(resolver.reverse).toHaveBeenCalledWith('2001:4860:4860::8888');
+  });
+
+  it('never reverse-resolves an address the caller marks private', async () => {
+    const resolver = stubResolver({ resolve4: vi.fn(async () => ['10.0.0.5']), resolve6: nxdomain });
+
+    const info = await lookupDns('intranet.example', resolver, (ip) => ip.startsWith('10.'));
+
+    expect(info).toEqual({ addresses: ['10.0.0.5'], ptr: [] });
+    expect(resolver.reverse).not.toHaveBeenCalled();
+  });
+});
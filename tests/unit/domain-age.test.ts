@@ -3,16 +3,12 @@ import { lookupDomainAge, registrableDomain, scoreAge } from '../../functions/ch
 
 function rdapResponse(createdDaysAgo: number): Response {
   const eventDate = new Date(Date.now() - createdDaysAgo * 24 * 60 * 60 * 1000).toISOString();
-  return {
-    ok: true,
-    status: 200,
-    json: async () => ({
-      events: [
-        { eventAction: 'registration', eventDate },
-        { eventAction: 'last changed', eventDate }
-      ]
-    })
-  } as unknown as Response;
+  return Response.json({
+    events: [
+      { eventAction: 'registration', eventDate },
+      { eventAction: 'last changed', eventDate }
+    ]
+  });
 }
 
 afterEach(() => {
@@ -33,8 +29,14 @@ describe('registrableDomain', () => {
 
 describe('scoreAge', () => {
   it('raises risk for very new domains', () => {
-    expect(scoreAge(5)).toMatchObject({ risk_points: 20 });
+    expect(scoreAge(5)).toMatchObject({ risk_points: 20, suspicious_new: true });
     expect(scoreAge(5).message).toContain('Very new domain');
+    expect(scoreAge(5).code).toBe('DOMAIN_VERY_NEW');
+  });
+
+  it('only flags domains under 30 days as suspicious_new', () => {
+    expect(scoreAge(29).suspicious_new).toBe(true);
+    expect(scoreAge(30).suspicious_new).toBe(false);
   });
 
   it('raises risk moderately for domains under 90 days', () => {
@@ -65,6 +67,8 @@ describe('lookupDomainAge', () => {
     );
     expect(result.age_days).toBe(10);
     expect(result.risk_points).toBe(20);
+    expect(result.suspicious_new).toBe(true);
+    expect(result.registered_at).toMatch(/^\d{4}-\d{2}-\d{2}T/);
   });
 
   it('caches determinate results per registrable domain', async () => {
@@ -80,11 +84,7 @@ describe('lookupDomainAge', () => {
   });
 
   it('degrades to unknown when RDAP has no registration event', async () => {
-    vi.stubGlobal('fetch', vi.fn(async () => ({
-      ok: true,
-      status: 200,
-      json: async () => ({ events: [] })
-    } as unknown as Response)));
+    vi.stubGlobal('fetch', vi.fn(async () => Response.json({ events: [] })));
 
     const result = await lookupDomainAge('no-events.example');
     expect(result.age_days).toBeNull();
@@ -102,6 +102,16 @@ describe('lookupDomainAge', () => {
     expect(result.risk_points).toBe(0);
   });
 
+  it('reports a missing RDAP record (404) as unknown, not as a failure', async () => {
+    vi.stubGlobal('fetch', vi.fn(async () => Response.json({}, { status: 404 })));
+
+    const result = await lookupDomainAge('unregistered.example');
+    expect(result.age_days).toBeNull();
+    expect(result.registered_at).toBeNull();
+    expect(result.suspicious_new).toBe(false);
+    expect(result.message).toBe('No registration record found for this domain');
+  });
+
   it('does not cache failed lookups', async () => {
     const failing = vi.fn(async () => {
       throw new Error('down');
@@ -0,0 +1,59 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { tmpdir } from 'node:os';
+import { join } from 'node:path';
+import { listFile } from '../helpers/list-file';
+import { matchesDomainList, parseDomainList } from '../../functions/lib/domain-lists';
+
+afterEach(() => {
+  vi.unstubAllEnvs();
+  vi.resetModules();
+  vi.restoreAllMocks();
+});
+
+describe('matchesDomainList', () => {
+  const entries = ['corp.example', '*.corp.example', '*.evil.test'];
+
+  it.each([
+    ['corp.example', true],
+    ['CORP.example.', true],
+    ['mail.corp.example', true],
+    ['a.b.evil.test', true],
+    ['evil.test', false],
+    ['notcorp.example', false],
+    ['corp.example.attacker.test', false]
+  ])('%s -> %s', (host, expected) => {
+    expect(matchesDomainList(host, entries)).toBe(expected);
+  });
+});
+
+describe('parseDomainList', () => {
+  it('reads one entry per line and skips comments and blank lines', () => {
+    const text = '# campaign 2024-07\r\nBad.Corp.Example.\n\n  *.evil.test  # whole zone\n';
+
+    expect(parseDomainList(text)).toEqual(['bad.corp.example', '*.evil.test']);
+  });
+});
+
+describe('listVerdict', () => {
+  it('reads both list files and lets the denylist win', async () => {
+    vi.stubEnv('DENYLIST_FILE', listFile('bad.corp.example\n*.evil.test\n'));
+    vi.stubEnv('ALLOWLIST_FILE', listFile('*.corp.example\n'));
+    vi.resetModules();
+    const { listVerdict } = await import('../../functions/lib/domain-lists');
+
+    expect(listVerdict('bad.corp.example')).toBe('blocked');
+    expect(listVerdict('x.evil.test')).toBe('blocked');
+    expect(listVerdict('mail.corp.example')).toBe('trusted');
+    expect(listVerdict('elsewhere.example')).toBeNull();
+  });
+
+  it('logs a missing file and treats the list as empty', async () => {
+    const error = vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.stubEnv('DENYLIST_FILE', join(tmpdir(), 'qrcheck-no-such-list.txt'));
+    vi.resetModules();
+    const { listVerdict } = await import('../../functions/lib/domain-lists');
+
+    expect(listVerdict('anything.example')).toBeNull();
+    expect(error).toHaveBeenCalledWith(expect.stringContaining('DENYLIST_FILE'), expect.anything());
+  });
+});
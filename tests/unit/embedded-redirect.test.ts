@@ -0,0 +1,78 @@
+import { describe, it, expect } from 'vitest';
+import { findEmbeddedRedirect, findOpenRedirect } from '../../functions/lib/embedded-redirect';
+
+const b64 = (text: string) => Buffer.from(text).toString('base64');
+
+describe('findEmbeddedRedirect', () => {
+  it('decodes a base64 ?url= target', () => {
+    const url = `https://trusted.example/out?url=${encodeURIComponent(b64('https://evil.example/login'))}`;
+
+    expect(findEmbeddedRedirect(url)).toEqual({
+      source: 'query_param',
+      param: 'url',
+      url: 'https://evil.example/login'
+    });
+  });
+
+  it('accepts unpadded, URL-safe base64 and an unescaped "+"', () => {
+    const encoded = b64('https://evil.example/x?y=1>').replace(/=+$/, '');
+    expect(findEmbeddedRedirect(`https://trusted.example/go?next=${encoded}`)?.url).toBe('https://evil.example/x?y=1%3E');
+    expect(findEmbeddedRedirect(`https://trusted.example/go?next=${encoded.replace(/\+/g, '-').replace(/\//g, '_')}`)?.url)
+      .toBe('https://evil.example/x?y=1%3E');
+  });
+
+  it('follows a meta refresh inside a base64 data: payload', () => {
+    const html = '<html><head><meta http-equiv="refresh" content="0; url=https://evil.example/p"></head></html>';
+
+    expect(findEmbeddedRedirect(`data:text/html;base64,${b64(html)}`)).toEqual({
+      source: 'data_url',
+      url: 'https://evil.example/p'
+    });
+  });
+
+  it('finds a script redirect in a percent-encoded data: payload', () => {
+    const html = '<script>location.replace("https://evil.example/js")</script>';
+
+    expect(findEmbeddedRedirect(`data:text/html,${encodeURIComponent(html)}`)?.url).toBe('https://evil.example/js');
+  });
+
+  it.each([
+    'https://shop.example/?token=abcdefghijklmnopqrstuvwx',
+    `https://shop.example/?session=${b64('not a url at all, just text')}`,
+    'https://shop.example/?next=/account',
+    'data:text/plain,hello',
+    'not a url'
+  ])('ignores %s', (url) => {
+    expect(findEmbeddedRedirect(url)).toBeNull();
+  });
+});
+
+describe('findOpenRedirect', () => {
+  it('flags a hop whose URL parameter the chain then followed to another host', () => {
+    const hops = [
+      'https://qr.example/abc',
+      'https://trusted.example/out?src=qr&url=https%3A%2F%2Fevil.example%2Flogin',
+      'https://evil.example/login'
+    ];
+
+    expect(findOpenRedirect(hops)).toEqual({ hop: 1, param: 'url', target: 'https://evil.example/login' });
+  });
+
+  it('sees through a base64 parameter too', () => {
+    const hops = [`https://trusted.example/r?d=${b64('https://evil.example/')}`, 'https://evil.example/'];
+
+    expect(findOpenRedirect(hops)).toMatchObject({ hop: 0, param: 'd' });
+  });
+
+  it('ignores a URL parameter the chain did not follow', () => {
+    const hops = ['https://login.example/?continue=https%3A%2F%2Fmail.example%2F', 'https://login.example/signin'];
+
+    expect(findOpenRedirect(hops)).toBeNull();
+  });
+
+  it('ignores a parameter pointing back to the same host', () => {
+    const hops = ['https://shop.example/go?next=https%3A%2F%2Fshop.example%2Fcart', 'https://shop.example/cart'];
+
+    expect(findOpenRedirect(hops)).toBeNull();
+  });
+});
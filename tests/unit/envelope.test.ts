@@ -0,0 +1,82 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import type { Handler } from '@netlify/functions';
+import { wantsEnvelope, withEnvelope } from '../../functions/lib/envelope';
+import { handler as urlhausHandler } from '../../functions/intel-urlhaus';
+
+interface HandlerResult {
+  statusCode: number;
+  headers: Record<string, string>;
+  body: string;
+}
+
+const json: Handler = async () => ({
+  statusCode: 200,
+  headers: { 'content-type': 'application/json', etag: '"abc"', vary: 'Accept-Language' },
+  body: JSON.stringify({ ok: true })
+});
+
+async function call(handler: Handler, event: Record<string, unknown>): Promise<HandlerResult> {
+  return (await handler({ headers: {}, ...event } as never, {} as never)) as HandlerResult;
+}
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+  vi.useRealTimers();
+});
+
+describe('wantsEnvelope', () => {
+  it.each([
+    [{ queryStringParameters: { envelope: 'true' } }, true],
+    [{ queryStringParameters: { envelope: '1' } }, true],
+    [{ queryStringParameters: { envelope: 'false' } }, false],
+    [{ headers: { accept: 'application/vnd.qrcheck.envelope+json' } }, true],
+    [{ headers: { accept: 'application/json' } }, false],
+    [{ headers: {} }, false]
+  ])('%j -> %s', (event, expected) => {
+    expect(wantsEnvelope({ headers: {}, queryStringParameters: null, ...event } as never)).toBe(expected);
+  });
+});
+
+describe('withEnvelope', () => {
+  it('leaves the bare shape as the default but varies on Accept', async () => {
+    const result = await call(withEnvelope(json), {});
+
+    expect(JSON.parse(result.body)).toEqual({ ok: true });
+    expect(result.headers.etag).toBe('"abc"');
+    expect(result.headers.vary).toBe('Accept-Language, Accept');
+  });
+
+  it('wraps the body with a version and timestamp on request', async () => {
+    vi.useFakeTimers({ now: new Date('2026-01-02T03:04:05Z') });
+
+    const result = await call(withEnvelope(json), { queryStringParameters: { envelope: 'true' } });
+
+    expect(JSON.parse(result.body)).toEqual({
+      version: '1',
+      generated_at: '2026-01-02T03:04:05.000Z',
+      data: { ok: true }
+    });
+    expect(result.headers.etag).toBeUndefined();
+    expect(result.headers['cache-control']).toBe('no-store');
+  });
+
+  it('passes non-JSON and empty bodies through', async () => {
+    const text: Handler = async () => ({ statusCode: 405, body: 'Method Not Allowed' });
+    const empty: Handler = async () => ({ statusCode: 304, body: '' });
+    const event = { queryStringParameters: { envelope: 'true' } };
+
+    expect((await call(withEnvelope(text), event)).body).toBe('Method Not Allowed');
+    expect((await call(withEnvelope(empty), event)).body).toBe('');
+  });
+
+  it('wraps error bodies from a real endpoint too', async () => {
+    const result = await call(urlhausHandler, {
+      httpMethod: 'GET',
+      headers: { 'x-nf-client-connection-ip': '198.51.100.7' },
+      queryStringParameters: { envelope: 'true' }
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body)).toMatchObject({ version: '1', data: { ok: false, error: 'missing url or host' } });
+  });
+});
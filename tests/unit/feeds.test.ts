@@ -0,0 +1,182 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { CircuitBreaker } from '../../functions/lib/circuit-breaker';
+import { runFeeds, ThrottledError, type Feed } from '../../functions/lib/feeds';
+
+const target = { url: 'https://example.com/', hostname: 'example.com', hostIsIp: false };
+
+function feed(overrides: Partial<Feed> & { name: string }): Feed {
+  return { configured: () => true, timeoutMs: 1_000, check: async () => ({ finding: null }), ...overrides };
+}
+
+afterEach(() => {
+  vi.restoreAllMocks();
+});
+
+describe('runFeeds', () => {
+  it('sums findings and reports every feed in order', async () => {
+    const report = await runFeeds(
+      [
+        feed({ name: 'A', check: async () => ({ finding: { code: 'GSB_MATCH', details: 'a', score: 40 } }) }),
+        feed({ name: 'B' }),
+        feed({ name: 'C', check: async () => ({ finding: { code: 'VIRUSTOTAL_DETECTIONS', details: 'c', score: 25 } }) })
+      ],
+      target
+    );
+
+    expect(report.riskPoints).toBe(65);
+    expect(report.threats.map(t => t.source)).toEqual(['A', 'C']);
+    expect(report.sourcesChecked).toEqual(['A', 'B', 'C']);
+    expect(report.sources).toEqual([
+      { name: 'A', status: 'ok' },
+      { name: 'B', status: 'ok' },
+      { name: 'C', status: 'ok' }
+    ]);
+  });
+
+  it('skips inapplicable feeds entirely and never calls unconfigured ones', async () => {
+    const check = vi.fn(async () => ({ finding: null }));
+    const report = await runFeeds(
+      [
+        feed({ name: 'IP only', appliesTo: t => t.hostIsIp, check }),
+        feed({ name: 'Keyless', configured: () => false, check })
+      ],
+      target
+    );
+
+    expect(check).not.toHaveBeenCalled();
+    expect(report.sources).toEqual([{ name: 'Keyless', status: 'not_configured' }]);
+    expect(report.sourcesChecked).toEqual([]);
+  });
+
+  it('runs a fallback feed without credentials and still scores it', async () => {
+    const report = await runFeeds(
+      [feed({
+        name: 'Heuristic',
+        configured: () => false,
+        fallback: true,
+        check: async () => ({ finding: { code: 'SUSPICIOUS_PATTERN', details: 'x', score: 20 } })
+      })],
+      target
+    );
+
+    expect(report.sources).toEqual([{ name: 'Heuristic', status: 'not_configured' }]);
+    expect(report.sourcesChecked).toEqual(['Heuristic']);
+    expect(report.riskPoints).toBe(20);
+  });
+
+  it('isolates failures and maps them to statuses', async () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const timeout = new DOMException('timed out', 'TimeoutError');
+    const report = await runFeeds(
+      [
+        feed({ name: 'Broken', check: async () => { throw new Error('boom'); } }),
+        feed({ name: 'Slow', check: async () => { throw timeout; } }),
+        feed({ name: 'Busy', check: async () => { throw new ThrottledError('quota'); } }),
+        feed({ name: 'Fine', check: async () => ({ finding: { code: 'GSB_MATCH', details: 'ok', score: 40 } }) })
+      ],
+      target
+    );
+
+    expect(report.sources.map(s => s.status)).toEqual(['error', 'timeout', 'throttled', 'ok']);
+    expect(report.riskPoints).toBe(40);
+  });
+
+  it('times a slow feed out on its own budget without holding up the others', async () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    let aborted = false;
+    const started = Date.now();
+    const report = await runFeeds(
+      [
+        feed({
+          name: 'Hanging',
+          timeoutMs: 20,
+          // Never settles; only the runner's deadline ends it
+          check: (_, signal) => {
+            signal.addEventListener('abort', () => { aborted = true; });
+            return new Promise(() => {});
+          }
+        }),
+        feed({ name: 'Fast', timeoutMs: 5_000, check: async () => ({ finding: { code: 'GSB_MATCH', details: 'x', score: 40 } }) })
+      ],
+      target
+    );
+
+    expect(Date.now() - started).toBeLessThan(1_000);
+    expect(aborted).toBe(true);
+    expect(report.sources).toEqual([
+      { name: 'Hanging', status: 'timeout' },
+      { name: 'Fast', status: 'ok' }
+    ]);
+    expect(report.riskPoints).toBe(40);
+  });
+
+  it("always sets a feed's response key, null unless it returned data", async () => {
+    const report = await runFeeds(
+      [
+        feed({ name: 'With data', responseKey: 'rich', check: async () => ({ finding: null, data: { hits: 1 } }) }),
+        feed({ name: 'Keyless', responseKey: 'empty', configured: () => false })
+      ],
+      target
+    );
+
+    expect(report.data).toEqual({ rich: { hits: 1 }, empty: null });
+  });
+
+  it('reports a feed with no record of the target as no_report and never trips its breaker', async () => {
+    const breaker = new CircuitBreaker('Sparse', 1, 60_000);
+    const sparse = feed({ name: 'Sparse', breaker, check: async () => ({ finding: null, noReport: true }) });
+
+    const report = await runFeeds([sparse], target);
+
+    expect(report.sources).toEqual([{ name: 'Sparse', status: 'no_report' }]);
+    expect(report.riskPoints).toBe(0);
+    expect(breaker.state()).toBe('closed');
+  });
+
+  it('skips a feed whose breaker is open until the cooldown passes', async () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const check = vi.fn(async (): Promise<never> => { throw new TypeError('fetch failed'); });
+    const flaky = feed({ name: 'Flaky', check, breaker: new CircuitBreaker('Flaky', 2, 60_000) });
+
+    await runFeeds([flaky], target);
+    await runFeeds([flaky], target);
+    const skipped = await runFeeds([flaky], target);
+
+    expect(check).toHaveBeenCalledTimes(2);
+    expect(skipped.sources).toEqual([{ name: 'Flaky', status: 'unavailable' }]);
+    expect(skipped.sourcesChecked).toEqual([]);
+  });
+
+  it('never trips a breaker on throttling', async () => {
+    const breaker = new CircuitBreaker('Throttled', 1, 60_000);
+    const throttled = feed({
+      name: 'Throttled',
+      breaker,
+      check: async () => { throw new ThrottledError('backing off'); }
+    });
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+
+    await runFeeds([throttled], target);
+
+    expect(breaker.state()).toBe('closed');
+  });
+
+  it('lets the next request probe again when a half-open probe is throttled', async () => {
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    // No cooldown: the breaker is half-open as soon as it opens
+    const breaker = new CircuitBreaker('Flaky', 1, 0);
+    const check = vi.fn(async (): Promise<never> => { throw new TypeError('fetch failed'); });
+    const flaky = feed({ name: 'Flaky', breaker, check });
+
+    await runFeeds([flaky], target);
+    expect(breaker.state()).toBe('half_open');
+
+    check.mockImplementationOnce(async () => { throw new ThrottledError('backing off'); });
+    const throttled = await runFeeds([flaky], target);
+    const next = await runFeeds([flaky], target);
+
+    expect(throttled.sources).toEqual([{ name: 'Flaky', status: 'throttled' }]);
+    expect(next.sources).toEqual([{ name: 'Flaky', status: 'error' }]);
+    expect(check).toHaveBeenCalledTimes(3);
+  });
+});
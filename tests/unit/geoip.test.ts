@@ -0,0 +1,54 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { fetchGeoIP } from '../../functions/lib/geoip';
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+  vi.unstubAllEnvs();
+  vi.restoreAllMocks();
+});
+
+describe('fetchGeoIP', () => {
+  it('reports not configured without a token and makes no request', async () => {
+    vi.stubEnv('IPINFO_TOKEN', '');
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    expect(await fetchGeoIP('93.184.216.34')).toEqual({ configured: false });
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('returns country, region and the ASN split from org', async () => {
+    vi.stubEnv('IPINFO_TOKEN', 'test-token');
+    const fetchMock = vi.fn(async () => Response.json({
+      ip: '93.184.216.34',
+      region: 'California',
+      country: 'US',
+      org: 'AS15133 Edgecast Inc.'
+    }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    expect(await fetchGeoIP('93.184.216.34')).toEqual({
+      configured: true,
+      ip: '93.184.216.34',
+      country: 'US',
+      region: 'California',
+      asn: 'AS15133',
+      org: 'Edgecast Inc.'
+    });
+    const [endpoint] = fetchMock.mock.calls[0] as unknown as [URL];
+    expect(endpoint.pathname).toBe('/93.184.216.34/json');
+    expect(endpoint.searchParams.get('token')).toBe('test-token');
+  });
+
+  it('reports an error instead of throwing when the lookup fails', async () => {
+    vi.stubEnv('IPINFO_TOKEN', 'test-token');
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    vi.stubGlobal('fetch', vi.fn(async () => new Response('', { status: 429 })));
+
+    expect(await fetchGeoIP('93.184.216.34')).toEqual({
+      configured: true,
+      ip: '93.184.216.34',
+      error: 'ipinfo request failed: 429'
+    });
+  });
+});
@@ -0,0 +1,43 @@
+import { describe, it, expect } from 'vitest';
+import { detectHomograph } from '../../functions/lib/homograph';
+
+// URL parsing converts IDNs to punycode, exactly as the resolver sees them
+const host = (raw: string) => new URL(`https://${raw}/`).hostname;
+
+describe('detectHomograph', () => {
+  it('passes a pure-ASCII domain', () => {
+    expect(detectHomograph('example.com')).toEqual({
+      ascii: 'example.com',
+      unicode: 'example.com',
+      punycode: false,
+      homograph_suspected: false
+    });
+  });
+
+  it.each(['münchen.de', 'пример.рф', 'bücher.example'])('passes the legitimate IDN %s', (raw) => {
+    const result = detectHomograph(host(raw));
+    expect(result.punycode).toBe(true);
+    expect(result.unicode).toBe(raw);
+    expect(result.homograph_suspected).toBe(false);
+  });
+
+  it('flags Latin mixed with a Cyrillic look-alike', () => {
+    const result = detectHomograph(host('аpple.com'));
+    expect(result.ascii).toBe('xn--pple-43d.com');
+    expect(result.unicode).toBe('аpple.com');
+    expect(result.homograph_suspected).toBe(true);
+  });
+
+  it('flags a label spelled entirely in look-alike letters', () => {
+    expect(detectHomograph(host('аррӏе.com')).homograph_suspected).toBe(true);
+  });
+
+  it('flags Greek look-alikes mixed into a Latin label', () => {
+    expect(detectHomograph(host('gοogle.com')).homograph_suspected).toBe(true);
+  });
+
+  it('leaves IP literals alone', () => {
+    expect(detectHomograph('[2606:4700::1111]').homograph_suspected).toBe(false);
+    expect(detectHomograph('93.184.216.34').punycode).toBe(false);
+  });
+});
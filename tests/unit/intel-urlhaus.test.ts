@@ -0,0 +1,408 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { listFile } from '../helpers/list-file';
+import { handler } from '../../functions/intel-urlhaus';
+
+interface HandlerResult {
+  statusCode: number;
+  headers?: Record<string, string>;
+  body: string;
+}
+
+// This suite exercises the lookups, not the limiter: raise its limit before
+// the handler module reads it at load.
+vi.hoisted(() => {
+  vi.stubEnv('RATE_LIMIT', '100000');
+});
+
+async function invoke(event: Record<string, unknown>): Promise<HandlerResult> {
+  return (await handler({ body: null, ...event, headers: { ...(event.headers as object) } } as never, {} as never)) as HandlerResult;
+}
+
+function urlhausResponse(payload: unknown): Response {
+  return Response.json(payload);
+}
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+  vi.unstubAllEnvs();
+  vi.restoreAllMocks();
+});
+
+describe('intel-urlhaus handler', () => {
+  it('answers a matching If-None-Match with 304', async () => {
+    vi.stubGlobal('fetch', vi.fn(async () => urlhausResponse({ query_status: 'no_results' })));
+    const query = { url: 'https://etag.example/' };
+
+    const first = await invoke({ httpMethod: 'GET', queryStringParameters: query });
+    const etag = first.headers?.etag;
+    expect(etag).toMatch(/^"[\w-]+"$/);
+
+    const second = await invoke({
+      httpMethod: 'GET',
+      queryStringParameters: query,
+      headers: { 'if-none-match': etag }
+    });
+    expect(second.statusCode).toBe(304);
+    expect(second.body).toBe('');
+    expect(second.headers?.etag).toBe(etag);
+
+    const stale = await invoke({
+      httpMethod: 'GET',
+      queryStringParameters: query,
+      headers: { 'if-none-match': '"something-else"' }
+    });
+    expect(stale.statusCode).toBe(200);
+  });
+
+  it('accepts GET with a url query parameter', async () => {
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({
+      httpMethod: 'GET',
+      queryStringParameters: { url: 'https://example.com/path' }
+    });
+
+    expect(result.statusCode).toBe(200);
+    expect(JSON.parse(result.body)).toMatchObject({ ok: true, query_status: 'no_results' });
+    const [endpoint, init] = fetchMock.mock.calls[0] as unknown as [string, RequestInit];
+    expect(endpoint).toBe('https://urlhaus.abuse.ch/api/v1/url/');
+    expect(String(init.body)).toBe('url=https%3A%2F%2Fexample.com%2Fpath');
+  });
+
+  it('accepts POST with a JSON body', async () => {
+    vi.stubGlobal('fetch', vi.fn(async () => urlhausResponse({ query_status: 'no_results' })));
+
+    const result = await invoke({
+      httpMethod: 'POST',
+      body: JSON.stringify({ url: 'https://example.com/' })
+    });
+
+    expect(result.statusCode).toBe(200);
+  });
+
+  it.each(['GET', 'POST'])('rejects a malformed url on %s with 400 before any lookup', async (method) => {
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke(method === 'GET'
+      ? { httpMethod: 'GET', queryStringParameters: { url: 'not a url' } }
+      : { httpMethod: 'POST', body: JSON.stringify({ url: 'not a url' }) });
+
+    expect(result.statusCode).toBe(400);
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('sanitizes the url before looking it up', async () => {
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: ' http ://sloppy.example/a\n' } });
+    const control = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://sloppy.example/\u0000' } });
+
+    expect(result.statusCode).toBe(200);
+    const [, init] = fetchMock.mock.calls[0] as unknown as [string, RequestInit];
+    expect(String(init.body)).toBe('url=http%3A%2F%2Fsloppy.example%2Fa');
+    expect(control.statusCode).toBe(400);
+    expect(JSON.parse(control.body).error).toBe('invalid url');
+  });
+
+  it('leaves the fragment out of the URLHaus query and the cache key', async () => {
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://frag.example/page#fragment' } });
+    await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://frag.example/page#other' } });
+
+    const [, init] = fetchMock.mock.calls[0] as unknown as [string, RequestInit];
+    expect(String(init.body)).toBe('url=https%3A%2F%2Ffrag.example%2Fpage');
+    // The second fragment is the same lookup, served from cache
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+  });
+
+  it('rejects an over-length url with 400 before any lookup', async () => {
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'POST', body: JSON.stringify({ url: `https://long.example/${'a'.repeat(9000)}` }) });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('url or host is longer than 8192 characters');
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it.each(['file:///etc/passwd', 'javascript:alert(1)'])('rejects %s with a scheme error', async (url) => {
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url } });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('only http and https URLs are supported');
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('serves a repeat lookup of the same URL from cache', async () => {
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const first = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://cached.example/a' } });
+    const second = await invoke({ httpMethod: 'POST', body: JSON.stringify({ url: 'https://CACHED.example/a' }) });
+
+    // One URL query and one host query, both from the first request only
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+    expect(JSON.parse(second.body)).toEqual(JSON.parse(first.body));
+  });
+
+  it('does not cache failed lookups', async () => {
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'invalid_url' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://flaky.example/' } });
+    await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://flaky.example/' } });
+
+    expect(fetchMock).toHaveBeenCalledTimes(4);
+  });
+
+  it.each([
+    ['clean', { url: 'no_results', host: 'no_results' }, 'public, s-maxage=3600, stale-while-revalidate=60'],
+    ['listed URL', { url: 'ok', host: 'no_results' }, 'public, s-maxage=21600, stale-while-revalidate=60'],
+    ['listed host', { url: 'no_results', host: 'ok' }, 'public, s-maxage=21600, stale-while-revalidate=60'],
+    ['unknown', { url: 'invalid_url', host: 'no_results' }, 'no-store'],
+    ['failed URL lookup on a listed host', { url: 'invalid_url', host: 'ok' }, 'no-store']
+  ])('sets the CDN cache window for a %s verdict', async (verdict, statuses, expected) => {
+    vi.stubGlobal('fetch', vi.fn(async (endpoint: string) =>
+      urlhausResponse({ query_status: endpoint.endsWith('/host/') ? statuses.host : statuses.url })));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: `https://ttl-${verdict.replace(/ /g, '-')}.example/` } });
+
+    expect(result.headers?.['netlify-cdn-cache-control']).toBe(expected);
+    expect(result.headers?.['cache-control']).toBe('no-store');
+  });
+
+  it('reads the per-verdict cache windows from the environment', async () => {
+    vi.stubEnv('INTEL_CLEAN_TTL', '120s');
+    vi.stubEnv('INTEL_UNKNOWN_TTL', '30');
+    vi.resetModules();
+    const { handler: configured } = await import('../../functions/intel-urlhaus');
+    const fetchMock = vi.fn(async (endpoint: string) =>
+      urlhausResponse({ query_status: endpoint.endsWith('/host/') ? 'no_results' : 'invalid_url' }));
+    vi.stubGlobal('fetch', fetchMock);
+    const call = async (url: string) =>
+      (await configured({ httpMethod: 'GET', headers: {}, body: null, queryStringParameters: { url } } as never, {} as never)) as HandlerResult;
+
+    const unknown = await call('https://env-unknown.example/');
+    await call('https://env-unknown.example/');
+    fetchMock.mockImplementation(async () => urlhausResponse({ query_status: 'no_results' }));
+    const clean = await call('https://env-clean.example/');
+
+    expect(unknown.headers?.['netlify-cdn-cache-control']).toBe('public, s-maxage=30, stale-while-revalidate=60');
+    expect(clean.headers?.['netlify-cdn-cache-control']).toBe('public, s-maxage=120, stale-while-revalidate=60');
+    // A non-zero unknown window also lets the warm cache reuse the answer
+    expect(fetchMock).toHaveBeenCalledTimes(4);
+  });
+
+  it('reports the host record alongside a clean exact-URL lookup', async () => {
+    const fetchMock = vi.fn(async (endpoint: string) => endpoint.endsWith('/host/')
+      ? urlhausResponse({
+          query_status: 'ok',
+          url_count: '12',
+          blacklists: { spamhaus_dbl: 'abused_legit_malware', surbl: 'not listed' },
+          urls: []
+        })
+      : urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://bad-host.example/new-path' } });
+    const data = JSON.parse(result.body);
+
+    expect(data.query_status).toBe('no_results');
+    expect(data.urlhaus_host).toEqual({
+      query_status: 'ok',
+      url_count: 12,
+      blacklists: { spamhaus_dbl: 'abused_legit_malware', surbl: 'not listed' }
+    });
+    const [, init] = fetchMock.mock.calls[1] as unknown as [string, RequestInit];
+    expect(String(init.body)).toBe('host=bad-host.example');
+  });
+
+  it('reports an exact-URL hit as a match with its url_status', async () => {
+    vi.stubGlobal('fetch', vi.fn(async (endpoint: string) => endpoint.endsWith('/host/')
+      ? urlhausResponse({ query_status: 'no_results' })
+      : urlhausResponse({
+          query_status: 'ok',
+          url: 'https://taken-down.example/payload.exe',
+          url_status: 'offline',
+          threat: 'malware_download'
+        })));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://taken-down.example/payload.exe' } });
+    const data = JSON.parse(result.body);
+
+    expect(data.url_status).toBe('offline');
+    expect(data.matches).toHaveLength(1);
+    expect(data.matches[0]).toMatchObject({ url: 'https://taken-down.example/payload.exe', threat: 'malware_download' });
+  });
+
+  it('treats a host listing as online while any of its URLs is', async () => {
+    vi.stubGlobal('fetch', vi.fn(async () => urlhausResponse({
+      query_status: 'ok',
+      urls: [{ url_status: 'offline' }, { url_status: 'online' }]
+    })));
+
+    const mixed = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'mixed.example' } });
+    expect(JSON.parse(mixed.body).url_status).toBe('online');
+
+    vi.stubGlobal('fetch', vi.fn(async () => urlhausResponse({
+      query_status: 'ok',
+      urls: [{ url_status: 'offline' }, { url_status: 'offline' }]
+    })));
+
+    const down = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'all-down.example' } });
+    expect(JSON.parse(down.body).url_status).toBe('offline');
+  });
+
+  it('keeps the URL result when only the host lookup fails', async () => {
+    vi.stubGlobal('fetch', vi.fn(async (endpoint: string) => {
+      if (endpoint.endsWith('/host/')) throw new TypeError('fetch failed');
+      return urlhausResponse({ query_status: 'no_results' });
+    }));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://host-down.example/' } });
+    const data = JSON.parse(result.body);
+
+    expect(result.statusCode).toBe(200);
+    expect(data.query_status).toBe('no_results');
+    expect(data.urlhaus_host).toMatchObject({ query_status: 'error', error: 'fetch failed' });
+  });
+
+  it('names the system error behind a transport failure', async () => {
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.stubGlobal('fetch', vi.fn(async () => {
+      throw new TypeError('fetch failed', {
+        cause: Object.assign(new Error('getaddrinfo ENOTFOUND urlhaus.abuse.ch'), { code: 'ENOTFOUND' })
+      });
+    }));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://dns-down.example/' } });
+
+    expect(result.statusCode).toBe(500);
+    expect(JSON.parse(result.body)).toEqual({
+      ok: false,
+      source: 'urlhaus',
+      query_status: 'error',
+      error: 'fetch failed (ENOTFOUND)'
+    });
+  });
+
+  it('includes the HTTP status when URLHaus answers with an error', async () => {
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.stubGlobal('fetch', vi.fn(async () => new Response('', { status: 503, statusText: 'Service Unavailable' })));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'http-down.example' } });
+
+    expect(JSON.parse(result.body).error).toBe('HTTP 503: Service Unavailable');
+  });
+
+  it('retries a transient upstream failure and recovers', async () => {
+    const fetchMock = vi.fn()
+      .mockResolvedValueOnce(new Response('', { status: 502, statusText: 'Bad Gateway' }))
+      .mockResolvedValueOnce(urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'blip.example' } });
+
+    expect(result.statusCode).toBe(200);
+    expect(JSON.parse(result.body).query_status).toBe('no_results');
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+  });
+
+  it('does not retry a 4xx', async () => {
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    const fetchMock = vi.fn(async () => new Response('', { status: 401, statusText: 'Unauthorized' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'no-key.example' } });
+
+    expect(JSON.parse(result.body).error).toBe('HTTP 401: Unauthorized');
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+  });
+
+  it('answers 503 without calling URLHaus once the breaker opens', async () => {
+    vi.stubEnv('BREAKER_THRESHOLD', '2');
+    vi.stubEnv('BREAKER_COOLDOWN', '60s');
+    vi.resetModules();
+    const { handler: configured } = await import('../../functions/intel-urlhaus');
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const fetchMock = vi.fn(async () => new Response('', { status: 401, statusText: 'Unauthorized' }));
+    vi.stubGlobal('fetch', fetchMock);
+    const call = async (host: string) =>
+      (await configured({ httpMethod: 'GET', headers: {}, body: null, queryStringParameters: { host } } as never, {} as never)) as HandlerResult;
+
+    await call('down-1.example');
+    await call('down-2.example');
+    const skipped = await call('down-3.example');
+
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+    expect(skipped.statusCode).toBe(503);
+    expect(JSON.parse(skipped.body).query_status).toBe('unavailable');
+    expect(Number(skipped.headers?.['retry-after'])).toBeGreaterThan(50);
+  });
+
+  it('reports a timeout distinctly from other failures', async () => {
+    vi.spyOn(console, 'error').mockImplementation(() => {});
+    vi.stubGlobal('fetch', vi.fn(async () => {
+      throw new DOMException('This operation was aborted', 'AbortError');
+    }));
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { host: 'slow.example' } });
+
+    expect(JSON.parse(result.body).error).toMatch(/^timeout after \d+ms$/);
+  });
+
+  it('sends URLHAUS_API_KEY as the Auth-Key header', async () => {
+    vi.stubEnv('URLHAUS_API_KEY', 'abuse-ch-key');
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://keyed.example/' } });
+
+    const [, init] = fetchMock.mock.calls[0] as unknown as [string, RequestInit];
+    expect((init.headers as Record<string, string>)['auth-key']).toBe('abuse-ch-key');
+    expect(JSON.parse(result.body).warning).toBeUndefined();
+  });
+
+  it('still looks up without a key but warns about it', async () => {
+    vi.stubEnv('URLHAUS_API_KEY', '');
+    const fetchMock = vi.fn(async () => urlhausResponse({ query_status: 'no_results' }));
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ httpMethod: 'GET', queryStringParameters: { url: 'https://unkeyed.example/' } });
+
+    const [, init] = fetchMock.mock.calls[0] as unknown as [string, RequestInit];
+    expect(init.headers).not.toHaveProperty('auth-key');
+    expect(JSON.parse(result.body).warning).toMatch(/URLHAUS_API_KEY/);
+  });
+
+  it('answers from the denylist without calling URLHaus', async () => {
+    vi.stubEnv('DENYLIST_FILE', listFile('*.evil.test\n'));
+    vi.resetModules();
+    const { handler: listed } = await import('../../functions/intel-urlhaus');
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = (await listed(
+      { httpMethod: 'GET', headers: {}, body: null, queryStringParameters: { url: 'https://login.evil.test/' } } as never,
+      {} as never
+    )) as HandlerResult;
+
+    expect(JSON.parse(result.body)).toMatchObject({ ok: true, query_status: 'skipped', verdict: 'blocked' });
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('rejects other methods with 405', async () => {
+    const result = await invoke({ httpMethod: 'DELETE' });
+    expect(result.statusCode).toBe(405);
+  });
+});
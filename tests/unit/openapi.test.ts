@@ -0,0 +1,48 @@
+import { describe, it, expect } from 'vitest';
+import { readdirSync } from 'node:fs';
+import { fileURLToPath } from 'node:url';
+import spec from '../../contracts/openapi.json';
+import { handler } from '../../functions/openapi';
+
+interface HandlerResult {
+  statusCode: number;
+  headers: Record<string, string>;
+  body: string;
+}
+
+const functionsDir = fileURLToPath(new URL('../../functions/', import.meta.url));
+
+describe('OpenAPI contract', () => {
+  it('documents every function endpoint', () => {
+    const functions = readdirSync(functionsDir)
+      .filter((name) => name.endsWith('.ts'))
+      .map((name) => `/${name.replace(/\.ts$/, '')}`);
+
+    expect(Object.keys(spec.paths).sort()).toEqual(functions.sort());
+  });
+
+  it('resolves every $ref inside the document', () => {
+    const refs = JSON.stringify(spec).match(/"#\/components\/[^"]+"/g) ?? [];
+    for (const ref of refs) {
+      const target = JSON.parse(ref).slice(2).split('/')
+        .reduce((node: Record<string, unknown> | undefined, key: string) =>
+          node?.[key] as Record<string, unknown> | undefined, spec as unknown as Record<string, unknown>);
+      expect(target, ref).toBeDefined();
+    }
+  });
+});
+
+describe('openapi handler', () => {
+  it('serves the spec as JSON', async () => {
+    const result = (await handler({ httpMethod: 'GET', headers: {} } as never, {} as never)) as HandlerResult;
+
+    expect(result.statusCode).toBe(200);
+    expect(result.headers['content-type']).toBe('application/json');
+    expect(JSON.parse(result.body).openapi).toBe('3.0.3');
+  });
+
+  it('rejects other methods', async () => {
+    const result = (await handler({ httpMethod: 'POST', headers: {} } as never, {} as never)) as HandlerResult;
+    expect(result.statusCode).toBe(405);
+  });
+});
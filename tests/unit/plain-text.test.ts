@@ -0,0 +1,105 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import type { Handler } from '@netlify/functions';
+import { wantsPlainText, withPlainText } from '../../functions/lib/plain-text';
+import { renderResolveText } from '../../functions/resolve';
+import { handler as urlhausHandler } from '../../functions/intel-urlhaus';
+
+interface HandlerResult {
+  statusCode: number;
+  headers: Record<string, string>;
+  body: string;
+}
+
+async function call(handler: Handler, event: Record<string, unknown>): Promise<HandlerResult> {
+  return (await handler({ headers: {}, ...event } as never, {} as never)) as HandlerResult;
+}
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+});
+
+describe('wantsPlainText', () => {
+  it.each([
+    ['text/plain', true],
+    ['text/plain, application/json', true],
+    ['application/json;q=0.5, text/plain', true],
+    ['application/json, text/plain', false],
+    ['text/plain;q=0.2, application/json', false],
+    ['*/*', false],
+    ['', false]
+  ])('%j -> %s', (accept, expected) => {
+    expect(wantsPlainText({ headers: { accept } } as never)).toBe(expected);
+  });
+});
+
+describe('withPlainText', () => {
+  const json = (statusCode: number, body: unknown): Handler => async () => ({
+    statusCode,
+    headers: { 'content-type': 'application/json', etag: '"abc"' },
+    body: JSON.stringify(body)
+  });
+
+  it('renders the body as text only when asked', async () => {
+    const wrapped = withPlainText((body) => [`answer: ${body.answer}`], json(200, { answer: 42 }));
+
+    const text = await call(wrapped, { headers: { accept: 'text/plain' } });
+    expect(text.body).toBe('answer: 42\n');
+    expect(text.headers['content-type']).toBe('text/plain; charset=utf-8');
+    expect(text.headers.etag).toBeUndefined();
+
+    const plain = await call(wrapped, {});
+    expect(JSON.parse(plain.body)).toEqual({ answer: 42 });
+  });
+
+  it('renders errors as a single line', async () => {
+    const wrapped = withPlainText(() => ['unused'], json(400, { ok: false, error: 'invalid url' }));
+
+    const result = await call(wrapped, { headers: { accept: 'text/plain' } });
+
+    expect(result.statusCode).toBe(400);
+    expect(result.body).toBe('error: invalid url\n');
+  });
+});
+
+describe('plain-text summaries', () => {
+  it('summarizes a resolve analysis', () => {
+    const lines = renderResolveText({
+      ok: true,
+      analysis: {
+        input_url: 'https://bit.ly/x',
+        resolved_url: 'https://paypa1-login.example/',
+        hop_count: 2,
+        partial: false,
+        shortener: 'bit.ly',
+        homograph: { homograph_suspected: false },
+        brand_impersonation: { brand: 'paypal.com', distance: 1 },
+        open_redirect_abused: null,
+        decoded_redirect: null
+      }
+    });
+
+    expect(lines).toEqual([
+      'input:    https://bit.ly/x',
+      'final:    https://paypa1-login.example/',
+      'hops:     2',
+      'findings:',
+      '  - shortened by bit.ly',
+      '  - imitates paypal.com (distance 1)'
+    ]);
+  });
+
+  it('serves a URLHaus verdict as text', async () => {
+    vi.stubGlobal('fetch', vi.fn(async (endpoint: string) => Response.json(endpoint.endsWith('/host/')
+      ? { query_status: 'ok', url_count: '3', urls: [] }
+      : { query_status: 'ok', url: 'https://gone.example/a.exe', url_status: 'offline' })));
+
+    const result = await call(urlhausHandler, {
+      httpMethod: 'GET',
+      headers: { 'x-nf-client-connection-ip': '192.0.2.251', accept: 'text/plain' },
+      queryStringParameters: { url: 'https://gone.example/a.exe' }
+    });
+
+    expect(result.statusCode).toBe(200);
+    expect(result.body).toMatch(/^urlhaus: {2}listed \(1 match, offline, previously malicious but appears inactive\)\nhost: {5}3 malicious URLs on record\n/);
+  });
+});
@@ -0,0 +1,230 @@
+import { describe, it, expect, afterEach, vi } from 'vitest';
+import { RateLimiter, getClientIP, parseAllowlist, parseRateLimits, rateLimitHeaders, withRateLimit } from '../../functions/lib/rate-limit';
+import { envDurationMs, envInt } from '../../functions/lib/env';
+
+describe('RateLimiter', () => {
+  it('allows a burst up to the configured limit', () => {
+    const limiter = new RateLimiter(3, 1000);
+    const now = 1_000_000;
+
+    expect([1, 2, 3].map(() => limiter.check('1.2.3.4', now).allowed)).toEqual([true, true, true]);
+    const refused = limiter.check('1.2.3.4', now);
+    expect(refused.allowed).toBe(false);
+    // The next token arrives after one refill interval, not a whole window
+    expect(refused.resetTime).toBe(now + Math.ceil(1000 / 3));
+  });
+
+  it('reports the remaining quota and when the bucket is full again', () => {
+    // 4 per second: one token every 250ms
+    const limiter = new RateLimiter(4, 1000);
+
+    expect(limiter.check('a', 0)).toMatchObject({ allowed: true, remaining: 3, fullAt: 250 });
+    expect(limiter.check('a', 0)).toMatchObject({ remaining: 2, fullAt: 500 });
+    expect(limiter.check('a', 100)).toMatchObject({ remaining: 1, fullAt: 750 });
+
+    const headers = rateLimitHeaders(limiter.limit, limiter.check('a', 2000));
+    expect(headers).toEqual({ 'x-ratelimit-limit': '4', 'x-ratelimit-remaining': '3', 'x-ratelimit-reset': '3' });
+  });
+
+  it('parses per-endpoint limits and skips malformed entries', () => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+
+    expect(parseRateLimits(['resolve:20', 'intel-urlhaus : 30', 'check-domain-age:0', 'bogus'])).toEqual(
+      new Map([['resolve', 20], ['intel-urlhaus', 30]])
+    );
+    expect(warn).toHaveBeenCalledTimes(2);
+    warn.mockRestore();
+  });
+
+  it('keys each endpoint\'s quota separately for the same client', async () => {
+    const ok = async () => ({ statusCode: 200, body: '' });
+    const resolve = withRateLimit(new RateLimiter(1, 60_000), ok);
+    const intel = withRateLimit(new RateLimiter(5, 60_000), ok);
+    const event = { headers: { 'x-nf-client-connection-ip': '203.0.113.50' } } as never;
+
+    expect((await resolve(event, {} as never))?.statusCode).toBe(200);
+    const refused = await resolve(event, {} as never);
+    expect(refused?.statusCode).toBe(429);
+    expect(refused?.headers?.['retry-after']).toMatch(/^\d+$/);
+
+    const allowed = await intel(event, {} as never);
+    expect(allowed?.statusCode).toBe(200);
+    expect(allowed?.headers).toMatchObject({ 'x-ratelimit-limit': '5', 'x-ratelimit-remaining': '4' });
+  });
+
+  it('never throttles allowlisted clients', async () => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+    const allowlist = parseAllowlist(['198.51.100.7', '203.0.113.0/24', '2001:db8::/32', '10.0.0.0/33', 'monitor.example']);
+    expect(warn).toHaveBeenCalledTimes(2);
+    warn.mockRestore();
+
+    const limited = withRateLimit(new RateLimiter(60, 60_000), async () => ({ statusCode: 200, body: '' }), allowlist);
+    const call = (ip: string) => limited({ headers: { 'x-nf-client-connection-ip': ip } } as never, {} as never);
+
+    for (const ip of ['203.0.113.9', '198.51.100.7', '2001:db8::1']) {
+      const statuses = new Set<number | undefined>();
+      for (let i = 0; i < 61; i++) statuses.add((await call(ip))?.statusCode);
+      expect(statuses).toEqual(new Set([200]));
+    }
+
+    for (let i = 0; i < 60; i++) await call('198.51.100.8');
+    expect((await call('198.51.100.8'))?.statusCode).toBe(429);
+  });
+
+  it('tracks clients independently', () => {
+    const limiter = new RateLimiter(1, 1000);
+    expect(limiter.check('a', 0).allowed).toBe(true);
+    expect(limiter.check('a', 0).allowed).toBe(false);
+    expect(limiter.check('b', 0).allowed).toBe(true);
+  });
+
+  it('refills at a steady rate once the burst is spent', () => {
+    // 2 per second: one token every 500ms
+    const limiter = new RateLimiter(2, 1000);
+    expect(limiter.check('a', 0).allowed).toBe(true);
+    expect(limiter.check('a', 0).allowed).toBe(true);
+    expect(limiter.check('a', 0).allowed).toBe(false);
+
+    expect(limiter.check('a', 250).allowed).toBe(false);
+    expect(limiter.check('a', 500).allowed).toBe(true);
+    expect(limiter.check('a', 500).allowed).toBe(false);
+    expect(limiter.check('a', 1000).allowed).toBe(true);
+    expect(limiter.check('a', 1500).allowed).toBe(true);
+  });
+
+  it('never accumulates more than the burst capacity while idle', () => {
+    const limiter = new RateLimiter(2, 1000);
+    limiter.check('a', 0);
+
+    const later = 60_000;
+    expect(limiter.check('a', later).allowed).toBe(true);
+    expect(limiter.check('a', later).allowed).toBe(true);
+    expect(limiter.check('a', later).allowed).toBe(false);
+  });
+
+  it('admits the client again after the refill interval', () => {
+    const limiter = new RateLimiter(1, 1000);
+    expect(limiter.check('a', 0).allowed).toBe(true);
+    expect(limiter.check('a', 500).allowed).toBe(false);
+    expect(limiter.check('a', 1001).allowed).toBe(true);
+  });
+});
+
+describe('RateLimiter eviction', () => {
+  it('sweeps clients whose bucket has fully refilled', () => {
+    const limiter = new RateLimiter(2, 1000, 5000);
+    limiter.check('idle', 0);
+    limiter.check('busy', 0);
+    limiter.check('busy', 0);
+    expect(limiter.size).toBe(2);
+
+    // 'idle' refilled long ago; 'busy' is still short a token
+    limiter.sweep(600);
+    expect(limiter.size).toBe(1);
+  });
+
+  it('sweeps automatically from check() once the interval has elapsed', () => {
+    const limiter = new RateLimiter(1, 1000, 5000);
+    limiter.check('stale', 0);
+
+    limiter.check('other', 4000);
+    expect(limiter.size).toBe(2);
+
+    limiter.check('other', 5000);
+    expect(limiter.size).toBe(1);
+  });
+
+  it('keeps enforcing the limit for clients that were not swept', () => {
+    const limiter = new RateLimiter(1, 1000, 1);
+    limiter.check('a', 0);
+    expect(limiter.check('a', 10).allowed).toBe(false);
+  });
+});
+
+describe('getClientIP', () => {
+  it('prefers the Netlify edge address', () => {
+    expect(getClientIP({
+      'x-nf-client-connection-ip': '198.51.100.7',
+      'x-forwarded-for': '203.0.113.1'
+    }, 1)).toBe('198.51.100.7');
+  });
+
+  it('ignores X-Forwarded-For unless proxy hops are trusted', () => {
+    expect(getClientIP({ 'x-forwarded-for': '203.0.113.1' })).toBe('unknown');
+  });
+
+  it('takes the entry added by the outermost trusted proxy, not the client-supplied ones', () => {
+    const headers = { 'x-forwarded-for': '6.6.6.6, 203.0.113.9, 10.0.0.2' };
+    expect(getClientIP(headers, 1)).toBe('10.0.0.2');
+    expect(getClientIP(headers, 2)).toBe('203.0.113.9');
+  });
+
+  it.each([
+    ['203.0.113.9:51234', '203.0.113.9'],
+    ['[2001:db8::1]:443', '2001:db8::1'],
+    ['2001:DB8::1', '2001:db8::1']
+  ])('strips ports and brackets from %s', (raw, expected) => {
+    expect(getClientIP({ 'x-forwarded-for': raw }, 1)).toBe(expected);
+  });
+
+  it('rejects values that are not IP addresses', () => {
+    expect(getClientIP({ 'x-forwarded-for': 'evil.example' }, 1)).toBe('unknown');
+    expect(getClientIP({ 'x-nf-client-connection-ip': 'garbage' })).toBe('unknown');
+  });
+});
+
+describe('envInt', () => {
+  afterEach(() => {
+    vi.unstubAllEnvs();
+  });
+
+  it('reads a positive integer', () => {
+    vi.stubEnv('QRCHECK_TEST_INT', '42');
+    expect(envInt('QRCHECK_TEST_INT', 7)).toBe(42);
+  });
+
+  it.each(['', '0', '-1', 'abc', '1.5'])('falls back for %j', (raw) => {
+    vi.stubEnv('QRCHECK_TEST_INT', raw);
+    expect(envInt('QRCHECK_TEST_INT', 7)).toBe(7);
+  });
+
+  it('falls back when unset', () => {
+    expect(envInt('QRCHECK_TEST_UNSET', 7)).toBe(7);
+  });
+});
+
+describe('envDurationMs', () => {
+  afterEach(() => {
+    vi.unstubAllEnvs();
+    vi.restoreAllMocks();
+  });
+
+  it.each([
+    ['10', 10_000],
+    ['10s', 10_000],
+    ['4500ms', 4_500]
+  ])('parses %j', (raw, expected) => {
+    vi.stubEnv('QRCHECK_TEST_DURATION', raw);
+    expect(envDurationMs('QRCHECK_TEST_DURATION', 1_000)).toBe(expected);
+  });
+
+  it.each(['0', '0ms', '-5s', '1.5s', '10m', 'soon'])('warns and falls back for %j', (raw) => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+    vi.stubEnv('QRCHECK_TEST_DURATION', raw);
+    expect(envDurationMs('QRCHECK_TEST_DURATION', 1_000)).toBe(1_000);
+    expect(warn).toHaveBeenCalledOnce();
+  });
+
+  it('falls back silently when unset', () => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+    expect(envDurationMs('QRCHECK_TEST_UNSET', 1_000)).toBe(1_000);
+    expect(warn).not.toHaveBeenCalled();
+  });
+
+  it.each(['0', '0s', '0ms'])('accepts %j silently when zero is the default', (raw) => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+    vi.stubEnv('QRCHECK_TEST_DURATION', raw);
+    expect(envDurationMs('QRCHECK_TEST_DURATION', 0)).toBe(0);
+    expect(warn).not.toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,28 @@
+import { describe, it, expect } from 'vitest';
+import { negotiateLocale, reasonText } from '../../functions/lib/reasons';
+
+describe('negotiateLocale', () => {
+  it.each([
+    [undefined, 'en'],
+    ['', 'en'],
+    ['fr-CA', 'fr'],
+    ['de-DE,fr;q=0.8,en;q=0.5', 'fr'],
+    ['en;q=0.4,fr;q=0.9', 'fr'],
+    ['fr;q=0,en', 'en'],
+    ['es, ja', 'en'],
+    ['*', 'en']
+  ])('%j -> %s', (header, expected) => {
+    expect(negotiateLocale(header)).toBe(expected);
+  });
+});
+
+describe('reasonText', () => {
+  it('fills placeholders', () => {
+    expect(reasonText('DOMAIN_VERY_NEW', 'en', { days: 3 })).toBe('Very new domain (3 days old)');
+    expect(reasonText('DOMAIN_ESTABLISHED', 'fr', { years: 7 })).toBe('Domaine établi (7 ans)');
+  });
+
+  it('falls back to English for an untranslated code', () => {
+    expect(reasonText('NO_THREATS')).toBe('No threats detected');
+  });
+});
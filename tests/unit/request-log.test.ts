@@ -0,0 +1,64 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { withRequestLog } from '../../functions/lib/request-log';
+
+interface HandlerResult {
+  statusCode: number;
+  headers: Record<string, string>;
+  body: string;
+}
+
+function event(headers: Record<string, string> = {}) {
+  return { httpMethod: 'POST', path: '/.netlify/functions/test', headers, body: null };
+}
+
+afterEach(() => {
+  vi.restoreAllMocks();
+});
+
+describe('withRequestLog', () => {
+  it('echoes Netlify\'s request ID and logs one structured line', async () => {
+    const log = vi.spyOn(console, 'log').mockImplementation(() => {});
+    const wrapped = withRequestLog('test', async () => ({
+      statusCode: 201,
+      headers: { 'content-type': 'application/json' },
+      body: '{}'
+    }));
+
+    const result = (await wrapped(event({
+      'x-nf-request-id': 'req-123',
+      'x-nf-client-connection-ip': '198.51.100.4'
+    }) as never, {} as never)) as HandlerResult;
+
+    expect(result.headers['x-request-id']).toBe('req-123');
+    expect(result.headers['content-type']).toBe('application/json');
+    expect(log).toHaveBeenCalledTimes(1);
+    expect(JSON.parse(log.mock.calls[0][0] as string)).toMatchObject({
+      level: 'info',
+      function: 'test',
+      request_id: 'req-123',
+      method: 'POST',
+      path: '/.netlify/functions/test',
+      client_ip: '198.51.100.4',
+      status: 201
+    });
+  });
+
+  it('generates a request ID when the platform did not supply one', async () => {
+    vi.spyOn(console, 'log').mockImplementation(() => {});
+    const wrapped = withRequestLog('test', async () => ({ statusCode: 200, body: '' }));
+
+    const result = (await wrapped(event() as never, {} as never)) as HandlerResult;
+
+    expect(result.headers['x-request-id']).toMatch(/^[0-9a-f-]{36}$/);
+  });
+
+  it('logs a 500 and rethrows when the handler throws', async () => {
+    const log = vi.spyOn(console, 'log').mockImplementation(() => {});
+    const wrapped = withRequestLog('test', async () => {
+      throw new Error('boom');
+    });
+
+    await expect(wrapped(event() as never, {} as never)).rejects.toThrow('boom');
+    expect(JSON.parse(log.mock.calls[0][0] as string)).toMatchObject({ level: 'error', status: 500 });
+  });
+});
@@ -4,9 +4,22 @@ import {
   isPrivateHost,
   isPrivateAddress,
   makeSsrfLookup,
-  BLOCKED_CODE
+  parseMaxHops,
+  dedupeHops,
+  MAX_HOPS_CEILING,
+  BLOCKED_CODE,
+  explainBlock,
+  geoTarget,
+  handler
 } from '../../functions/resolve';
 
+// The handler's transport. Validation tests assert it is never reached.
+const undiciFetch = vi.hoisted(() => vi.fn());
+vi.mock('undici', async (importOriginal) => ({
+  ...(await importOriginal<typeof import('undici')>()),
+  fetch: undiciFetch
+}));
+
 interface StubResponse {
   status: number;
   headers: { get(name: string): string | null };
@@ -93,19 +106,183 @@ describe('followRedirectChain', () => {
     expect(result.hops[1]).toBe('https://real.example/');
   });
 
-  it('treats a non-redirect, non-405/501 HEAD response as final without a GET', async () => {
+  it('falls back to a ranged GET when a server answers HEAD with 403 but redirects GET', async () => {
+    const fetchImpl = vi.fn(async (_url: string, init: { method: string }) => {
+      if (init.method === 'HEAD') return finalResponse(403);
+      return redirectTo('https://real.example/');
+    });
+
+    const result = await followRedirectChain('https://cdn-guarded.example/', {
+      fetchImpl: fetchImpl as never,
+      maxHops: 2
+    });
+
+    expect(result.hops).toEqual(['https://cdn-guarded.example/', 'https://real.example/']);
+  });
+
+  it('discards the GET fallback body without reading it', async () => {
+    const cancel = vi.fn(async () => {});
+    const fetchImpl = vi.fn(async (_url: string, init: { method: string }) => {
+      if (init.method === 'HEAD') return finalResponse(405);
+      return { ...finalResponse(200), body: { cancel } };
+    });
+
+    const result = await followRedirectChain('https://ignores-range.example/', { fetchImpl: fetchImpl as never });
+
+    expect(result.partial).toBe(false);
+    expect(cancel).toHaveBeenCalledOnce();
+  });
+
+  it('treats a non-redirect HEAD response that is not a method rejection as final without a GET', async () => {
     const methods: string[] = [];
     const fetchImpl = vi.fn(async (_url: string, init: { method: string }) => {
       methods.push(init.method);
-      return finalResponse(403);
+      return finalResponse(404);
     });
 
-    const result = await followRedirectChain('https://forbidden.example/', { fetchImpl: fetchImpl as never });
+    const result = await followRedirectChain('https://missing.example/', { fetchImpl: fetchImpl as never });
 
     expect(result.partial).toBe(false);
     expect(methods).toEqual(['HEAD']);
   });
 
+  it('records the status code and method of every hop', async () => {
+    const fetchImpl = vi.fn(async (url: string, init: { method: string }) => {
+      if (url === 'https://short.example/a') return { status: 302, headers: new Headers({ location: 'https://mid.example/' }) };
+      if (url === 'https://mid.example/' && init.method === 'HEAD') return finalResponse(405);
+      if (url === 'https://mid.example/') return { status: 307, headers: new Headers({ location: 'https://real.example/' }) };
+      return finalResponse(200);
+    });
+
+    const result = await followRedirectChain('https://short.example/a', { fetchImpl: fetchImpl as never });
+
+    expect(result.details).toEqual([
+      { url: 'https://short.example/a', status: 302, method: 'HEAD' },
+      { url: 'https://mid.example/', status: 307, method: 'GET' },
+      { url: 'https://real.example/', status: 200, method: 'HEAD' }
+    ]);
+  });
+
+  it('carries cookies between hops only when asked to', async () => {
+    // Two "servers": the gate sets a session cookie and redirects; the
+    // landing host only redirects onward when that cookie comes back.
+    const fetchImpl = vi.fn(async (url: string, init: { headers: Record<string, string> }) => {
+      if (url === 'https://gate.example/') {
+        const headers = new Headers({ location: 'https://app.gate.example/landing' });
+        headers.append('set-cookie', 'session=ok; Domain=gate.example; Path=/; Secure');
+        return { status: 302, headers };
+      }
+      if (url === 'https://app.gate.example/landing') {
+        return init.headers.cookie === 'session=ok'
+          ? redirectTo('https://real.example/')
+          : finalResponse(403);
+      }
+      return finalResponse();
+    });
+
+    const withCookies = await followRedirectChain('https://gate.example/', { fetchImpl: fetchImpl as never, cookies: true });
+    expect(withCookies.resolvedUrl).toBe('https://real.example/');
+
+    const without = await followRedirectChain('https://gate.example/', { fetchImpl: fetchImpl as never });
+    expect(without.resolvedUrl).toBe('https://app.gate.example/landing');
+    expect(without.details[1].status).toBe(403);
+  });
+
+  it('presents as the requested client on every hop', async () => {
+    // A cloaking kit: phones are sent on to the payload, anything else sees a parked page
+    const fetchImpl = vi.fn(async (url: string, init: { headers: Record<string, string> }) => {
+      if (url === 'https://cloak.example/') {
+        return /iPhone/.test(init.headers['user-agent']) ? redirectTo('https://payload.example/') : finalResponse();
+      }
+      return finalResponse();
+    });
+    const client = { name: 'mobile-ios', user_agent: 'Mozilla/5.0 (iPhone) Safari', accept_language: 'en-US', mobile: true };
+
+    const scanner = await followRedirectChain('https://cloak.example/', { fetchImpl: fetchImpl as never });
+    const phone = await followRedirectChain('https://cloak.example/', { fetchImpl: fetchImpl as never, client });
+
+    expect(scanner.resolvedUrl).toBe('https://cloak.example/');
+    expect(phone.resolvedUrl).toBe('https://payload.example/');
+    expect(fetchImpl.mock.calls[2][1].headers).toMatchObject({ 'accept-language': 'en-US', 'sec-ch-ua-mobile': '?1' });
+  });
+
+  it('records verbatim Location headers in raw mode only', async () => {
+    const fetchImpl = vi.fn(async (url: string) => {
+      if (url === 'https://short.example/a') return redirectTo('/%6Cogin?next=1');
+      if (url === 'https://short.example/%6Cogin?next=1') return redirectTo('HTTPS://Real.Example/');
+      return finalResponse();
+    });
+
+    const raw = await followRedirectChain('https://short.example/a', { fetchImpl: fetchImpl as never, rawLocations: true });
+
+    expect(raw.details[0]).toMatchObject({
+      location_raw: '/%6Cogin?next=1',
+      location_resolved: 'https://short.example/%6Cogin?next=1'
+    });
+    expect(raw.details[1]).toMatchObject({
+      location_raw: 'HTTPS://Real.Example/',
+      location_resolved: 'https://real.example/'
+    });
+    expect(raw.details[2].location_raw).toBeUndefined();
+
+    const plain = await followRedirectChain('https://short.example/a', { fetchImpl: fetchImpl as never });
+    expect(plain.details[0]).not.toHaveProperty('location_raw');
+  });
+
+  it('captures whitelisted headers and cookie names in headers mode only', async () => {
+    const fetchImpl = vi.fn(async (url: string) => {
+      if (url === 'https://short.example/a') {
+        const headers = new Headers({ location: 'https://real.example/', server: 'nginx', 'x-internal-token': 'secret' });
+        headers.append('set-cookie', 'sid=abc123; HttpOnly; Path=/');
+        headers.append('set-cookie', 'track=xyz');
+        return { status: 302, headers };
+      }
+      return { status: 200, headers: new Headers({ 'content-security-policy': "default-src 'self'" }) };
+    });
+
+    const result = await followRedirectChain('https://short.example/a', { fetchImpl: fetchImpl as never, responseHeaders: true });
+
+    expect(result.details[0].headers).toEqual({ server: 'nginx' });
+    expect(result.details[0].set_cookie).toEqual(['sid', 'track']);
+    expect(JSON.stringify(result.details)).not.toContain('abc123');
+    expect(result.details[1]).toMatchObject({
+      headers: { 'content-security-policy': "default-src 'self'" },
+      set_cookie: []
+    });
+
+    const plain = await followRedirectChain('https://short.example/a', { fetchImpl: fetchImpl as never });
+    expect(plain.details[0]).not.toHaveProperty('headers');
+    expect(plain.details[0]).not.toHaveProperty('set_cookie');
+  });
+
+  it('leaves status null and flags a blocked hop that was never fetched', async () => {
+    const { fetchImpl } = stubChain({
+      'https://public.example/': 'http://10.0.0.1/'
+    });
+
+    const result = await followRedirectChain('https://public.example/', { fetchImpl });
+
+    expect(result.details[1]).toEqual({
+      url: 'http://10.0.0.1/',
+      status: null,
+      method: null,
+      blocked: { reason: 'private_ip', ip: '10.0.0.1' }
+    });
+  });
+
+  it('records but never follows a redirect to a non-http scheme', async () => {
+    const { calls, fetchImpl } = stubChain({
+      'https://public.example/': 'file:///etc/passwd'
+    });
+
+    const result = await followRedirectChain('https://public.example/', { fetchImpl });
+
+    expect(result.partial).toBe(true);
+    expect(result.reason).toBe('unsupported_scheme');
+    expect(result.hops).toEqual(['https://public.example/', 'file:///etc/passwd']);
+    expect(calls).toHaveLength(1);
+  });
+
   it('detects redirect loops and returns the partial chain', async () => {
     const { fetchImpl } = stubChain({
       'https://a.example/': 'https://b.example/',
@@ -191,7 +368,7 @@ describe('followRedirectChain', () => {
     const fetchImpl = vi.fn(async (url: string) => {
       if (url === 'https://public.example/') return redirectTo('https://rebind.example/');
       throw new TypeError('fetch failed', {
-        cause: Object.assign(new Error('Refusing to connect'), { code: BLOCKED_CODE })
+        cause: Object.assign(new Error('Refusing to connect'), { code: BLOCKED_CODE, address: '169.254.169.254' })
       });
     });
 
@@ -200,6 +377,65 @@ describe('followRedirectChain', () => {
     expect(result.partial).toBe(true);
     expect(result.reason).toBe('blocked');
     expect(result.hops).toEqual(['https://public.example/', 'https://rebind.example/']);
+    expect(result.details[1].blocked).toEqual({ reason: 'metadata_endpoint', ip: '169.254.169.254' });
+    expect(result.details[0].blocked).toBeUndefined();
+  });
+
+  it('blocks a redirect to loopback', async () => {
+    const { calls, fetchImpl } = stubChain({
+      'https://public.example/': 'http://127.0.0.1:8080/'
+    });
+
+    const result = await followRedirectChain('https://public.example/', { fetchImpl });
+
+    expect(result.reason).toBe('blocked');
+    expect(result.details[1]).toMatchObject({ url: 'http://127.0.0.1:8080/', blocked: { reason: 'loopback', ip: '127.0.0.1' } });
+    expect(calls).toHaveLength(1);
+  });
+
+  it('follows a redirect to a public IPv6 literal', async () => {
+    const { calls, fetchImpl } = stubChain({
+      'https://public.example/': 'https://[2606:4700:4700::1111]:8443/landing',
+      'https://[2606:4700:4700::1111]:8443/landing': ''
+    });
+
+    const result = await followRedirectChain('https://public.example/', { fetchImpl });
+
+    expect(result.partial).toBe(false);
+    expect(result.resolvedUrl).toBe('https://[2606:4700:4700::1111]:8443/landing');
+    expect(calls).toHaveLength(2);
+  });
+
+  it.each([
+    ['http://[::1]:8080/', 'loopback'],
+    ['http://[fe80::1]/', 'link_local'],
+    ['http://[fd00::7]/admin', 'private_ip'],
+    ['http://[::ffff:127.0.0.1]/', 'loopback']
+  ])(
+    'blocks a redirect to the non-public IPv6 literal %s',
+    async (target, reason) => {
+      const { calls, fetchImpl } = stubChain({ 'https://public.example/': target });
+
+      const result = await followRedirectChain('https://public.example/', { fetchImpl });
+
+      expect(result.reason).toBe('blocked');
+      expect(result.details[1].blocked?.reason).toBe(reason);
+      expect(calls).toHaveLength(1);
+    }
+  );
+
+  it('follows private hops when private addresses are allowed (local testing)', async () => {
+    const { calls, fetchImpl } = stubChain({
+      'http://127.0.0.1:8080/': 'http://10.1.2.3/landing',
+      'http://10.1.2.3/landing': ''
+    });
+
+    const result = await followRedirectChain('http://127.0.0.1:8080/', { fetchImpl, allowPrivate: true });
+
+    expect(result.partial).toBe(false);
+    expect(result.resolvedUrl).toBe('http://10.1.2.3/landing');
+    expect(result.details.some((d) => d.blocked)).toBe(false);
+    expect(calls).toHaveLength(2);
   });
 
   it('treats a network error as a partial result instead of throwing', async () => {
@@ -215,6 +451,59 @@ describe('followRedirectChain', () => {
   });
 });
 
+describe('dedupeHops', () => {
+  const detail = (url: string, status: number) => ({ url, status, method: 'HEAD' as const });
+
+  it('collapses a chain bouncing between example.com and example.com/', () => {
+    const hops = ['https://qr.example/x', 'https://example.com', 'https://example.com/', 'https://EXAMPLE.com', 'https://example.com/'];
+    const details = hops.map((url, i) => detail(url, i === hops.length - 1 ? 200 : 301));
+
+    const result = dedupeHops(hops, details);
+
+    expect(result.hops).toEqual(['https://qr.example/x', 'https://example.com/']);
+    expect(result.details).toEqual([details[0], details[4]]);
+  });
+
+  it('collapses case and trailing-slash variants of a path but keeps the query', () => {
+    const hops = ['https://example.com/Promo', 'https://example.com/promo/', 'https://example.com/promo?ref=qr'];
+    const details = hops.map((url) => detail(url, 301));
+
+    expect(dedupeHops(hops, details).hops).toEqual(['https://example.com/promo/', 'https://example.com/promo?ref=qr']);
+  });
+
+  it('keeps hops whose query values differ only in case', () => {
+    const hops = ['https://example.com/login?token=AbC123', 'https://example.com/login?token=abc123'];
+
+    expect(dedupeHops(hops, hops.map((url) => detail(url, 302))).hops).toEqual(hops);
+  });
+
+  it('never merges a hop with one further back in the chain', () => {
+    const hops = ['https://a.example/', 'https://b.example/', 'https://a.example/'];
+
+    expect(dedupeHops(hops, hops.map((url) => detail(url, 302))).hops).toEqual(hops);
+  });
+});
+
+describe('parseMaxHops', () => {
+  it.each([
+    ['1', 1],
+    ['15', 15],
+    [' 12 ', 12],
+    [String(MAX_HOPS_CEILING), MAX_HOPS_CEILING],
+    ['100', MAX_HOPS_CEILING]
+  ])('%s -> %s', (raw, expected) => {
+    expect(parseMaxHops(raw)).toBe(expected);
+  });
+
+  it.each(['', '0', '-3', 'ten', '2.5', '1e3'])('rejects %j', (raw) => {
+    expect(parseMaxHops(raw)).toBeNull();
+  });
+
+  it('returns null when unset', () => {
+    expect(parseMaxHops(undefined)).toBeNull();
+  });
+});
+
 describe('makeSsrfLookup', () => {
   type LookupResult = Array<{ address: string; family: number }>;
 
@@ -309,6 +598,42 @@ describe('isPrivateAddress', () => {
   });
 });
 
+describe('geoTarget', () => {
+  it('locates the first address of a chain that was not blocked', () => {
+    expect(geoTarget(['93.184.215.14', '2606:2800:21f:cb07:6820:80da:af6b:8b2c'])).toBe('93.184.215.14');
+  });
+
+  it('never sends a blocked chain or a private/reserved address to ipinfo.io', () => {
+    expect(geoTarget(['93.184.215.14'], 'blocked')).toBeNull();
+    expect(geoTarget(['10.0.0.5'])).toBeNull();
+    expect(geoTarget(['169.254.169.254'], 'timeout')).toBeNull();
+    expect(geoTarget(['fd00::1'])).toBeNull();
+    expect(geoTarget([])).toBeNull();
+  });
+});
+
+describe('explainBlock', () => {
+  it.each([
+    ['169.254.169.254', 'metadata_endpoint'],
+    ['100.100.100.200', 'metadata_endpoint'],
+    ['fd00:ec2::254', 'metadata_endpoint'],
+    ['127.0.0.53', 'loopback'],
+    ['[::1]', 'loopback'],
+    ['169.254.10.1', 'link_local'],
+    ['fe80::1%eth0', 'link_local'],
+    ['10.1.2.3', 'private_ip'],
+    ['100.64.0.1', 'private_ip'],
+    ['::ffff:192.168.1.1', 'private_ip']
+  ])('explains %s as %s', (ip, reason) => {
+    expect(explainBlock(ip).reason).toBe(reason);
+  });
+
+  it('reports the bare address, or none for a localhost name', () => {
+    expect(explainBlock('[::1]')).toEqual({ reason: 'loopback', ip: '::1' });
+    expect(explainBlock('app.localhost')).toEqual({ reason: 'loopback', ip: null });
+  });
+});
+
 describe('isPrivateHost', () => {
   it.each([
     ['127.0.0.1', true],
@@ -321,9 +646,128 @@ describe('isPrivateHost', () => {
     ['0.0.0.0', true],
     ['::1', true],
     ['[::1]', true],
+    ['[fe80::1]', true],
+    ['[::ffff:7f00:1]', true],
+    ['[2606:4700:4700::1111]', false],
     ['example.com', false],
     ['8.8.8.8', false]
   ])('%s -> %s', (host, expected) => {
     expect(isPrivateHost(host)).toBe(expected);
   });
 });
+
+describe('resolve handler', () => {
+  interface HandlerResult {
+    statusCode: number;
+    headers: Record<string, string>;
+    body: string;
+  }
+
+  function invoke(event: Record<string, unknown>): Promise<HandlerResult> {
+    return handler({ httpMethod: 'POST', headers: {}, body: null, ...event } as never, {} as never) as Promise<HandlerResult>;
+  }
+
+  it('sets a numeric Retry-After once a client exceeds the limit', async () => {
+    // Invalid input is rejected after the limiter runs, so no network is touched
+    const event = {
+      headers: { 'x-nf-client-connection-ip': '198.51.100.13' },
+      body: JSON.stringify({ url: 'not a url' })
+    };
+
+    let result = await invoke(event);
+    for (let i = 0; i < 50 && result.statusCode !== 429; i++) {
+      result = await invoke(event);
+    }
+
+    expect(result.statusCode).toBe(429);
+    expect(result.headers['retry-after']).toMatch(/^\d+$/);
+    expect(Number(result.headers['retry-after'])).toBeGreaterThanOrEqual(1);
+  });
+
+  it('exposes the remaining quota on every response', async () => {
+    const event = {
+      headers: { 'x-nf-client-connection-ip': '198.51.100.47' },
+      body: JSON.stringify({ url: 'not a url' })
+    };
+
+    const first = await invoke(event);
+    const second = await invoke(event);
+
+    expect(first.statusCode).toBe(400);
+    expect(first.headers['x-ratelimit-limit']).toMatch(/^\d+$/);
+    expect(Number(second.headers['x-ratelimit-remaining'])).toBe(Number(first.headers['x-ratelimit-remaining']) - 1);
+    expect(Number(first.headers['x-ratelimit-reset'])).toBeGreaterThanOrEqual(Math.floor(Date.now() / 1000));
+  });
+
+  it.each([
+    ['http://[::1]/', { reason: 'loopback', ip: '::1' }],
+    ['https://[fe80::1]:8443/x', { reason: 'link_local', ip: 'fe80::1' }]
+  ])('rejects the private IPv6 input %s and says why', async (url, blocked) => {
+    const result = await invoke({
+      headers: { 'x-nf-client-connection-ip': '198.51.100.45' },
+      body: JSON.stringify({ url })
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('Resolution of private addresses is not allowed');
+    expect(JSON.parse(result.body).blocked).toEqual(blocked);
+  });
+
+  it('rejects a data: payload but reports the URL it leads to', async () => {
+    const html = '<meta http-equiv="refresh" content="0;url=https://evil.example/">';
+    const result = await invoke({
+      headers: { 'x-nf-client-connection-ip': '198.51.100.46' },
+      body: JSON.stringify({ url: `data:text/html;base64,${Buffer.from(html).toString('base64')}` })
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).decoded_redirect).toEqual({ source: 'data_url', url: 'https://evil.example/' });
+  });
+
+  it('rejects a claimed_domain that is not a domain name', async () => {
+    const result = await invoke({
+      headers: { 'x-nf-client-connection-ip': '198.51.100.49' },
+      body: JSON.stringify({ url: 'https://shop.example/', claimed_domain: 'see poster' })
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('claimed_domain must be a domain name');
+  });
+
+  it('rejects an unknown client profile', async () => {
+    const result = await invoke({
+      headers: { 'x-nf-client-connection-ip': '198.51.100.50' },
+      body: JSON.stringify({ url: 'https://shop.example/', profile: 'smart-fridge' })
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('profile must be one of mobile-ios, mobile-android, desktop');
+  });
+
+  it('rejects an over-length URL before any network call', async () => {
+    undiciFetch.mockClear();
+    const result = await invoke({
+      headers: { 'x-nf-client-connection-ip': '198.51.100.48' },
+      body: JSON.stringify({ url: `https://long.example/?q=${'a'.repeat(9000)}` })
+    });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('URL is longer than 8192 characters');
+    expect(undiciFetch).not.toHaveBeenCalled();
+  });
+
+  it.each(['file:///etc/passwd', 'javascript:alert(1)', 'ftp://files.example/'])(
+    'rejects %s with a scheme error before any network call',
+    async (url) => {
+      undiciFetch.mockClear();
+      const result = await invoke({
+        headers: { 'x-nf-client-connection-ip': '198.51.100.44' },
+        body: JSON.stringify({ url })
+      });
+
+      expect(result.statusCode).toBe(400);
+      expect(JSON.parse(result.body).error).toBe('Only http and https URLs can be resolved');
+      expect(undiciFetch).not.toHaveBeenCalled();
+    }
+  );
+});
@@ -0,0 +1,50 @@
+import { describe, it, expect, vi } from 'vitest';
+import { HttpStatusError, isRetryable, withRetry } from '../../functions/lib/retry';
+
+describe('isRetryable', () => {
+  it.each([
+    ['a network failure', new TypeError('fetch failed'), true],
+    ['a 503', new HttpStatusError(503, 'Service Unavailable'), true],
+    ['a 429', new HttpStatusError(429, 'Too Many Requests'), false],
+    ['a 404', new HttpStatusError(404, 'Not Found'), false],
+    ['a timeout', new DOMException('aborted', 'AbortError'), false],
+    ['a parse error', new SyntaxError('Unexpected token'), false]
+  ])('%s -> %s', (_, error, expected) => {
+    expect(isRetryable(error)).toBe(expected);
+  });
+});
+
+describe('withRetry', () => {
+  it('recovers when the first attempt fails transiently', async () => {
+    const fn = vi.fn()
+      .mockRejectedValueOnce(new HttpStatusError(502, 'Bad Gateway'))
+      .mockResolvedValueOnce('ok');
+
+    await expect(withRetry(fn, { attempts: 3, baseDelayMs: 1 })).resolves.toBe('ok');
+    expect(fn).toHaveBeenCalledTimes(2);
+  });
+
+  it('gives up after the configured attempts with the last error', async () => {
+    const fn = vi.fn(async () => { throw new TypeError('fetch failed'); });
+
+    await expect(withRetry(fn, { attempts: 3, baseDelayMs: 1 })).rejects.toThrow('fetch failed');
+    expect(fn).toHaveBeenCalledTimes(3);
+  });
+
+  it('never retries a client error', async () => {
+    const fn = vi.fn(async () => { throw new HttpStatusError(400, 'Bad Request'); });
+
+    await expect(withRetry(fn, { attempts: 3, baseDelayMs: 1 })).rejects.toThrow('HTTP 400: Bad Request');
+    expect(fn).toHaveBeenCalledTimes(1);
+  });
+
+  it('stops waiting when the deadline passes mid-backoff', async () => {
+    const ctrl = new AbortController();
+    const fn = vi.fn(async () => { throw new TypeError('fetch failed'); });
+    setTimeout(() => ctrl.abort(), 5);
+
+    await expect(withRetry(fn, { attempts: 3, baseDelayMs: 10_000, signal: ctrl.signal }))
+      .rejects.toMatchObject({ name: 'AbortError' });
+    expect(fn).toHaveBeenCalledTimes(1);
+  });
+});
@@ -0,0 +1,78 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { lookupUrl, sanitizeUrl } from '../../functions/lib/sanitize-url';
+
+afterEach(() => {
+  vi.unstubAllEnvs();
+  vi.resetModules();
+});
+
+describe('sanitizeUrl', () => {
+  it.each([
+    ['  https://example.com/a \n', 'https://example.com/a'],
+    ['http ://example.com/', 'http://example.com/'],
+    ['HTTPS: // example.com/', 'https://example.com/'],
+    ['https//example.com/', 'https://example.com/'],
+    ['https:/example.com/', 'https://example.com/'],
+    ['hxxps://evil.example/', 'https://evil.example/'],
+    ['example.com/path?q=1', 'https://example.com/path?q=1'],
+    ['example.com:8080/', 'https://example.com:8080/'],
+    ['//cdn.example/x', 'https://cdn.example/x']
+  ])('cleans %j to %s', (input, expected) => {
+    expect(sanitizeUrl(input)).toBe(expected);
+  });
+
+  it.each(['javascript:alert(1)', 'file:///etc/passwd', 'mailto:a@example.com'])(
+    'leaves the %s scheme for the caller to refuse',
+    (input) => {
+      expect(sanitizeUrl(input)).toBe(input);
+    }
+  );
+
+  it.each(['', '   ', 'https://exa\u0000mple.com/', 'https://example.com/\u202egnp.exe', 'https://exa\u200bmple.com/'])(
+    'rejects %j',
+    (input) => {
+      expect(sanitizeUrl(input)).toBeNull();
+    }
+  );
+
+  it('never throws on arbitrary input', () => {
+    // Small deterministic PRNG so a failure reproduces
+    let seed = 0x9e3779b9;
+    const next = () => {
+      seed ^= seed << 13;
+      seed ^= seed >>> 17;
+      seed ^= seed << 5;
+      return (seed >>> 0) / 0x100000000;
+    };
+    const alphabet = ['h', 't', 'p', 's', 'x', ':', '/', '\\', ' ', '.', '%', '#', '?', '@', '[', ']',
+      '\u0000', '\t', '\u007f', '\u0085', '\u200b', '\u202e', '\ufeff', 'é', '😀', '\ud800'];
+
+    for (let i = 0; i < 5000; i++) {
+      const length = Math.floor(next() * 40);
+      let input = '';
+      for (let j = 0; j < length; j++) input += alphabet[Math.floor(next() * alphabet.length)];
+
+      const result = sanitizeUrl(input);
+      if (result !== null) {
+        expect(result).toBe(result.trim());
+        expect(result).toMatch(/^[a-z][a-z0-9+.-]*:/i);
+      }
+    }
+  });
+});
+
+describe('lookupUrl', () => {
+  it('drops the fragment and nothing else', () => {
+    expect(lookupUrl('https://Example.com/a%20b?q=1#section')).toBe('https://Example.com/a%20b?q=1');
+    expect(lookupUrl('https://example.com/#/route#inner')).toBe('https://example.com/');
+    expect(lookupUrl('https://example.com/')).toBe('https://example.com/');
+  });
+
+  it('keeps the fragment when KEEP_URL_FRAGMENTS is set', async () => {
+    vi.stubEnv('KEEP_URL_FRAGMENTS', 'true');
+    vi.resetModules();
+    const { lookupUrl: configured } = await import('../../functions/lib/sanitize-url');
+
+    expect(configured('https://example.com/#token')).toBe('https://example.com/#token');
+  });
+});
@@ -0,0 +1,60 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import type { Handler } from '@netlify/functions';
+import { referrerPolicy, withSecurityHeaders } from '../../functions/lib/security-headers';
+import { handler as urlhausHandler } from '../../functions/intel-urlhaus';
+
+interface HandlerResult {
+  statusCode: number;
+  headers: Record<string, string>;
+}
+
+afterEach(() => {
+  vi.restoreAllMocks();
+});
+
+describe('withSecurityHeaders', () => {
+  it('adds nosniff, frame denial, CSP and Referrer-Policy', async () => {
+    const wrapped = withSecurityHeaders(async () => ({ statusCode: 200, body: '{}' }));
+
+    const result = (await wrapped({} as never, {} as never)) as HandlerResult;
+
+    expect(result.headers).toMatchObject({
+      'x-content-type-options': 'nosniff',
+      'x-frame-options': 'DENY',
+      'content-security-policy': "default-src 'none'; frame-ancestors 'none'",
+      'referrer-policy': 'no-referrer'
+    });
+  });
+
+  it('lets a header set by the handler win', async () => {
+    const inner: Handler = async () => ({ statusCode: 200, headers: { 'referrer-policy': 'origin' }, body: '' });
+
+    const result = (await withSecurityHeaders(inner)({} as never, {} as never)) as HandlerResult;
+
+    expect(result.headers['referrer-policy']).toBe('origin');
+  });
+
+  it('is applied to function responses, including errors', async () => {
+    const result = (await urlhausHandler({ httpMethod: 'DELETE', headers: {} } as never, {} as never)) as HandlerResult;
+
+    expect(result.statusCode).toBe(405);
+    expect(result.headers['x-content-type-options']).toBe('nosniff');
+    expect(result.headers['x-frame-options']).toBe('DENY');
+  });
+});
+
+describe('referrerPolicy', () => {
+  it('accepts a valid policy case-insensitively', () => {
+    expect(referrerPolicy(' Strict-Origin-When-Cross-Origin ')).toBe('strict-origin-when-cross-origin');
+  });
+
+  it('defaults to no-referrer when unset', () => {
+    expect(referrerPolicy(undefined)).toBe('no-referrer');
+  });
+
+  it('warns and falls back on an invalid policy', () => {
+    const warn = vi.spyOn(console, 'warn').mockImplementation(() => {});
+    expect(referrerPolicy('sometimes')).toBe('no-referrer');
+    expect(warn).toHaveBeenCalledOnce();
+  });
+});
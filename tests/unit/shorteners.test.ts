@@ -0,0 +1,33 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { detectShortener } from '../../functions/lib/shorteners';
+
+afterEach(() => {
+  vi.unstubAllEnvs();
+  vi.resetModules();
+});
+
+describe('detectShortener', () => {
+  it.each([
+    ['bit.ly', 'bit.ly'],
+    ['BIT.LY', 'bit.ly'],
+    ['t.co', 't.co'],
+    ['www.tinyurl.com', 'tinyurl.com'],
+    ['bit.ly.', 'bit.ly']
+  ])('%s -> %s', (host, expected) => {
+    expect(detectShortener(host)).toBe(expected);
+  });
+
+  it.each(['example.com', 'notbit.ly', 'ly', 'bit.ly.evil.example'])('%s is not a shortener', (host) => {
+    expect(detectShortener(host)).toBeNull();
+  });
+
+  it('extends the list from SHORTENER_HOSTS', async () => {
+    vi.stubEnv('SHORTENER_HOSTS', 'go.corp.example, Links.Example ,');
+    vi.resetModules();
+    const fresh = await import('../../functions/lib/shorteners');
+
+    expect(fresh.detectShortener('go.corp.example')).toBe('go.corp.example');
+    expect(fresh.detectShortener('links.example')).toBe('links.example');
+    expect(fresh.detectShortener('bit.ly')).toBe('bit.ly');
+  });
+});
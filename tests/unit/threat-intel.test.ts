@@ -0,0 +1,327 @@
+import { describe, it, expect, vi, beforeEach, afterEach } from 'vitest';
+import { listFile } from '../helpers/list-file';
+import { handler } from '../../functions/check-threat-intel';
+
+interface HandlerResult {
+  statusCode: number;
+  body: string;
+}
+
+// This suite exercises the lookups, not the limiter: raise its limit before
+// the handler module reads it at load.
+vi.hoisted(() => {
+  vi.stubEnv('RATE_LIMIT', '100000');
+});
+
+async function invoke(body: Record<string, unknown>): Promise<HandlerResult> {
+  const event = {
+    httpMethod: 'POST',
+    headers: {},
+    body: JSON.stringify(body)
+  };
+  return (await handler(event as never, {} as never)) as HandlerResult;
+}
+
+function jsonResponse(payload: unknown, status = 200): Response {
+  return Response.json(payload, { status });
+}
+
+beforeEach(() => {
+  // Keep VT and abuse.ch keys from the developer's shell out of the exact-match tests
+  vi.stubEnv('VT_API_KEY', '');
+  vi.stubEnv('URLHAUS_API_KEY', '');
+});
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+  vi.unstubAllEnvs();
+  vi.useRealTimers();
+});
+
+describe('check-threat-intel handler', () => {
+  it('queries every feed even when one of them fails', async () => {
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.stubEnv('ABUSEIPDB_API_KEY', 'abuse-test-key');
+
+    const fetchMock = vi.fn(async (input: string | URL) => {
+      const url = String(input);
+      if (url.startsWith('https://safebrowsing.googleapis.com/')) {
+        throw new TypeError('fetch failed');
+      }
+      if (url.startsWith('https://api.abuseipdb.com/')) {
+        return jsonResponse({ data: { abuseConfidenceScore: 90, totalReports: 42 } });
+      }
+      throw new Error(`Unexpected fetch: ${url}`);
+    });
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ url: 'http://203.0.113.7/login' });
+    const data = JSON.parse(result.body);
+
+    const called = fetchMock.mock.calls.map(([input]) => new URL(String(input)).hostname);
+    expect(called).toEqual(expect.arrayContaining(['safebrowsing.googleapis.com', 'api.abuseipdb.com']));
+    expect(result.statusCode).toBe(200);
+    expect(data.sources_checked).toEqual(['Google Safe Browsing', 'AbuseIPDB']);
+    expect(data.threats).toHaveLength(1);
+    expect(data.threats[0].source).toBe('AbuseIPDB');
+  });
+
+  it('starts both lookups before either one settles', async () => {
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.stubEnv('ABUSEIPDB_API_KEY', 'abuse-test-key');
+
+    let inFlight = 0;
+    let maxInFlight = 0;
+    vi.stubGlobal('fetch', vi.fn(async (input: string | URL) => {
+      inFlight++;
+      maxInFlight = Math.max(maxInFlight, inFlight);
+      await new Promise((r) => setTimeout(r, 10));
+      inFlight--;
+      return String(input).startsWith('https://api.abuseipdb.com/')
+        ? jsonResponse({ data: { abuseConfidenceScore: 0, totalReports: 0 } })
+        : jsonResponse({ fullHashes: [] });
+    }));
+
+    await invoke({ url: 'http://203.0.113.7/' });
+
+    expect(maxInFlight).toBe(2);
+  });
+
+  it.each(['file:///etc/passwd', 'javascript:alert(1)'])('rejects %s before querying any feed', async (url) => {
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = await invoke({ url });
+
+    expect(result.statusCode).toBe(400);
+    expect(JSON.parse(result.body).error).toBe('Only http and https URLs are supported');
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('reports per-source status so a failed feed is not mistaken for a clean one', async () => {
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.stubEnv('ABUSEIPDB_API_KEY', 'abuse-test-key');
+    vi.stubGlobal('fetch', vi.fn(async (input: string | URL) => {
+      if (String(input).startsWith('https://safebrowsing.googleapis.com/')) {
+        throw new DOMException('The operation was aborted due to timeout', 'TimeoutError');
+      }
+      throw new TypeError('fetch failed');
+    }));
+
+    const data = JSON.parse((await invoke({ url: 'http://203.0.113.7/' })).body);
+
+    expect(data.threat_detected).toBe(false);
+    expect(data.sources).toEqual([
+      { name: 'Google Safe Browsing', status: 'timeout' },
+      { name: 'AbuseIPDB', status: 'error' },
+      { name: 'VirusTotal', status: 'not_configured' },
+      { name: 'ThreatFox', status: 'not_configured' }
+    ]);
+  });
+
+  it('marks feeds without an API key as not configured', async () => {
+    vi.stubEnv('GSB_API_KEY', '');
+    vi.stubEnv('ABUSEIPDB_API_KEY', '');
+    vi.stubGlobal('fetch', vi.fn());
+
+    const data = JSON.parse((await invoke({ url: 'http://203.0.113.7/' })).body);
+
+    expect(data.sources).toEqual([
+      { name: 'Google Safe Browsing', status: 'not_configured' },
+      { name: 'AbuseIPDB', status: 'not_configured' },
+      { name: 'VirusTotal', status: 'not_configured' },
+      { name: 'ThreatFox', status: 'not_configured' }
+    ]);
+  });
+
+  it('lists only the feeds that apply to a hostname destination', async () => {
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.stubGlobal('fetch', vi.fn(async () => jsonResponse({ fullHashes: [] })));
+
+    const data = JSON.parse((await invoke({ url: 'https://shop.example/' })).body);
+
+    expect(data.sources).toEqual([
+      { name: 'Google Safe Browsing', status: 'ok' },
+      { name: 'VirusTotal', status: 'not_configured' },
+      { name: 'ThreatFox', status: 'not_configured' }
+    ]);
+  });
+
+  it.each([
+    ['blocked', 'phish.evil.test', true, 100],
+    ['trusted', 'intranet.corp.example', false, 0]
+  ])('returns a %s verdict from the deployment lists without querying any feed', async (verdict, host, detected, points) => {
+    vi.stubEnv('DENYLIST_FILE', listFile('*.evil.test\n'));
+    vi.stubEnv('ALLOWLIST_FILE', listFile('*.corp.example\n'));
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.resetModules();
+    const { handler: listed } = await import('../../functions/check-threat-intel');
+    const fetchMock = vi.fn();
+    vi.stubGlobal('fetch', fetchMock);
+
+    const result = (await listed(
+      { httpMethod: 'POST', headers: {}, body: JSON.stringify({ url: `https://${host}/` }) } as never,
+      {} as never
+    )) as HandlerResult;
+    const data = JSON.parse(result.body);
+
+    expect(data).toMatchObject({ verdict, threat_detected: detected, risk_points: points, sources: [] });
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it('pairs the summary with a stable code and localizes it from Accept-Language', async () => {
+    vi.stubEnv('ABUSEIPDB_API_KEY', 'abuse-test-key');
+    vi.stubGlobal('fetch', vi.fn(async () => jsonResponse({ data: { abuseConfidenceScore: 90, totalReports: 42 } })));
+    const event = (language: string) => ({
+      httpMethod: 'POST',
+      headers: { 'accept-language': language },
+      body: JSON.stringify({ url: 'https://203.0.113.9/' })
+    });
+
+    const english = (await handler(event('en-US,en;q=0.9') as never, {} as never)) as HandlerResult & { headers: Record<string, string> };
+    const french = (await handler(event('fr-CA,fr;q=0.9,en;q=0.5') as never, {} as never)) as HandlerResult & { headers: Record<string, string> };
+    const en = JSON.parse(english.body);
+    const fr = JSON.parse(french.body);
+
+    expect(en.code).toBe(fr.code);
+    expect(en.threats.map((t: { code: string }) => t.code)).toContain('ABUSEIPDB_REPORTED');
+    expect(fr.message).not.toBe(en.message);
+    expect(french.headers['content-language']).toBe('fr');
+    expect(english.headers['content-language']).toBe('en');
+  });
+
+  it('scores VirusTotal engine detections and links the report', async () => {
+    vi.stubEnv('GSB_API_KEY', 'gsb-test-key');
+    vi.stubEnv('VT_API_KEY', 'vt-test-key');
+    const fetchMock = vi.fn(async (input: string | URL) => {
+      if (String(input).startsWith('https://www.virustotal.com/')) {
+        return jsonResponse({
+          data: {
+            id: 'abc123',
+            attributes: { last_analysis_stats: { malicious: 5, suspicious: 1, harmless: 60, undetected: 20 } }
+          }
+        });
+      }
+      return jsonResponse({ fullHashes: [] });
+    });
+    vi.stubGlobal('fetch', fetchMock);
+
+    const data = JSON.parse((await invoke({ url: 'https://shop.example/pay' })).body);
+
+    const vtCall = fetchMock.mock.calls.find(([input]) => String(input).includes('virustotal'));
+    expect(String(vtCall?.[0])).toBe(
+      `https://www.virustotal.com/api/v3/urls/${Buffer.from('https://shop.example/pay').toString('base64url')}`
+    );
+    expect(data.virustotal).toEqual({
+      malicious: 5,
+      suspicious: 1,
+      harmless: 60,
+      undetected: 20,
+      permalink: 'https://www.virustotal.com/gui/url/abc123'
+    });
+    expect(data.threats).toEqual([{
+      source: 'VirusTotal',
+      code: 'VIRUSTOTAL_DETECTIONS',
+      details: '5 engines flagged malicious, 1 suspicious',
+      score: 50
+    }]);
+    expect(data.sources).toContainEqual({ name: 'VirusTotal', status: 'ok' });
+  });
+
+  it('reports no_report, not ok, for a URL VirusTotal has never seen', async () => {
+    vi.stubEnv('VT_API_KEY', 'vt-test-key');
+    vi.stubGlobal('fetch', vi.fn(async () => jsonResponse({ error: { code: 'NotFoundError' } }, 404)));
+
+    const data = JSON.parse((await invoke({ url: 'https://fresh.example/' })).body);
+
+    expect(data.virustotal).toBeNull();
+    expect(data.threat_detected).toBe(false);
+    expect(data.sources).toContainEqual({ name: 'VirusTotal', status: 'no_report' });
+  });
+
+  it('backs off VirusTotal after a 429 instead of retrying every request', async () => {
+    // Pin the clock in the past so the back-off window has long expired for
+    // any test that runs after this one on the real clock.
+    vi.useFakeTimers({ toFake: ['Date'] });
+    vi.setSystemTime(new Date('2020-01-01T00:00:00Z'));
+    vi.stubEnv('VT_API_KEY', 'vt-test-key');
+    const fetchMock = vi.fn(async (input: string | URL) =>
+      String(input).startsWith('https://www.virustotal.com/')
+        ? jsonResponse({ error: { code: 'QuotaExceededError' } }, 429)
+        : jsonResponse({ fullHashes: [] })
+    );
+    vi.stubGlobal('fetch', fetchMock);
+    const vtCalls = () => fetchMock.mock.calls.filter(([input]) => String(input).includes('virustotal')).length;
+
+    const first = JSON.parse((await invoke({ url: 'https://shop.example/' })).body);
+    const second = JSON.parse((await invoke({ url: 'https://other.example/' })).body);
+
+    expect(first.sources).toContainEqual({ name: 'VirusTotal', status: 'throttled' });
+    expect(second.sources).toContainEqual({ name: 'VirusTotal', status: 'throttled' });
+    expect(vtCalls()).toBe(1);
+
+    vi.setSystemTime(new Date('2020-01-01T00:01:01Z'));
+    await invoke({ url: 'https://third.example/' });
+    expect(vtCalls()).toBe(2);
+  });
+
+  it('scores ThreatFox IOCs for the host with the abuse.ch Auth-Key', async () => {
+    vi.stubEnv('URLHAUS_API_KEY', 'abuse-ch-key');
+    const fetchMock = vi.fn(async (input: string | URL) => {
+      if (String(input).startsWith('https://threatfox-api.abuse.ch/')) {
+        return jsonResponse({
+          query_status: 'ok',
+          data: [
+            { ioc: 'c2.example', ioc_type: 'domain', threat_type: 'botnet_cc', malware_printable: 'Cobalt Strike', confidence_level: 100, first_seen: '2024-05-01 10:00:00 UTC', last_seen: null },
+            { ioc: 'c2.example', ioc_type: 'domain', threat_type: 'payload_delivery', malware_printable: 'Emotet', confidence_level: 50, first_seen: null, last_seen: null }
+          ]
+        });
+      }
+      return jsonResponse({ fullHashes: [] });
+    });
+    vi.stubGlobal('fetch', fetchMock);
+
+    const data = JSON.parse((await invoke({ url: 'https://c2.example/gate.php' })).body);
+
+    const [, init] = fetchMock.mock.calls.find(([input]) => String(input).includes('threatfox')) as unknown as [string, RequestInit];
+    expect(JSON.parse(String(init.body))).toEqual({ query: 'search_ioc', search_term: 'c2.example' });
+    expect((init.headers as Record<string, string>)['auth-key']).toBe('abuse-ch-key');
+    expect(data.threatfox).toHaveLength(2);
+    expect(data.threatfox[0]).toMatchObject({ malware: 'Cobalt Strike', threat_type: 'botnet_cc', confidence_level: 100 });
+    expect(data.threats).toContainEqual({
+      source: 'ThreatFox',
+      code: 'THREATFOX_IOC',
+      details: '2 IOCs (Cobalt Strike, Emotet), confidence up to 100%',
+      score: 50
+    });
+  });
+
+  it('treats a ThreatFox no_result as clean', async () => {
+    vi.stubEnv('URLHAUS_API_KEY', 'abuse-ch-key');
+    vi.stubGlobal('fetch', vi.fn(async (input: string | URL) =>
+      String(input).startsWith('https://threatfox-api.abuse.ch/')
+        ? jsonResponse({ query_status: 'no_result', data: 'Your search did not yield any results' })
+        : jsonResponse({ fullHashes: [] })
+    ));
+
+    const data = JSON.parse((await invoke({ url: 'https://fresh.example/' })).body);
+
+    expect(data.threatfox).toEqual([]);
+    expect(data.threats).toEqual([]);
+    expect(data.sources).toContainEqual({ name: 'ThreatFox', status: 'ok' });
+  });
+
+  it('reports a rejected ThreatFox query as an error', async () => {
+    vi.stubEnv('URLHAUS_API_KEY', 'stale-key');
+    vi.stubGlobal('fetch', vi.fn(async (input: string | URL) =>
+      String(input).startsWith('https://threatfox-api.abuse.ch/')
+        ? jsonResponse({ query_status: 'unknown_auth_key' })
+        : jsonResponse({ fullHashes: [] })
+    ));
+
+    const data = JSON.parse((await invoke({ url: 'https://shop.example/' })).body);
+
+    expect(data.threatfox).toBeNull();
+    expect(data.sources).toContainEqual({ name: 'ThreatFox', status: 'error' });
+  });
+});
@@ -0,0 +1,62 @@
+import { describe, it, expect } from 'vitest';
+import type { PeerCertificate } from 'node:tls';
+import { fetchTlsInfo, summarizeCertificate } from '../../functions/lib/tls-info';
+
+function cert(overrides: Record<string, unknown> = {}): PeerCertificate {
+  return {
+    subject: { CN: 'shop.example' },
+    issuer: { C: 'US', O: "Let's Encrypt", CN: 'R11' },
+    subjectaltname: 'DNS:shop.example, DNS:www.shop.example',
+    valid_from: 'Sep  1 00:00:00 2026 GMT',
+    valid_to: 'Nov 30 00:00:00 2026 GMT',
+    ...overrides
+  } as unknown as PeerCertificate;
+}
+
+const NOW = Date.parse('2026-10-15T00:00:00Z');
+
+describe('summarizeCertificate', () => {
+  it('summarizes a valid certificate for the host', () => {
+    expect(summarizeCertificate(cert(), 'www.shop.example', NOW)).toEqual({
+      subject: 'shop.example',
+      issuer: "Let's Encrypt",
+      valid_from: '2026-09-01T00:00:00.000Z',
+      valid_to: '2026-11-30T00:00:00.000Z',
+      san: ['shop.example', 'www.shop.example'],
+      self_signed: false,
+      expired: false,
+      hostname_mismatch: false
+    });
+  });
+
+  it('flags a certificate issued to a different host', () => {
+    expect(summarizeCertificate(cert(), 'bank.example', NOW).hostname_mismatch).toBe(true);
+  });
+
+  it('flags an expired certificate', () => {
+    const expired = cert({ valid_to: 'Jan  1 00:00:00 2026 GMT' });
+    expect(summarizeCertificate(expired, 'shop.example', NOW).expired).toBe(true);
+  });
+
+  it('flags a self-signed certificate', () => {
+    const selfSigned = cert({ issuer: { CN: 'shop.example' } });
+    const info = summarizeCertificate(selfSigned, 'shop.example', NOW);
+    expect(info.self_signed).toBe(true);
+    expect(info.issuer).toBe('shop.example');
+  });
+
+  it('strips IP Address prefixes from the SAN list', () => {
+    const withIp = cert({ subjectaltname: 'DNS:localhost, IP Address:127.0.0.1' });
+    expect(summarizeCertificate(withIp, 'localhost', NOW).san).toEqual(['localhost', '127.0.0.1']);
+  });
+});
+
+describe('fetchTlsInfo', () => {
+  it('returns an empty object for plain-http URLs without connecting', async () => {
+    expect(await fetchTlsInfo('http://shop.example/')).toEqual({});
+  });
+
+  it('returns an empty object for unparseable URLs', async () => {
+    expect(await fetchTlsInfo('not a url')).toEqual({});
+  });
+});
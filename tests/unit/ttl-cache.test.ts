@@ -0,0 +1,52 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import { MemoryCache } from '../../functions/lib/ttl-cache';
+
+afterEach(() => {
+  vi.useRealTimers();
+});
+
+describe('MemoryCache', () => {
+  it('returns a value until its TTL runs out', async () => {
+    vi.useFakeTimers();
+    const cache = new MemoryCache<string>();
+    await cache.set('a', 'one', 1_000);
+
+    vi.advanceTimersByTime(999);
+    expect(await cache.get('a')).toBe('one');
+
+    vi.advanceTimersByTime(1);
+    expect(await cache.get('a')).toBeUndefined();
+  });
+
+  it('keeps a separate expiry per entry', async () => {
+    vi.useFakeTimers();
+    const cache = new MemoryCache<number>();
+    await cache.set('short', 1, 100);
+    await cache.set('long', 2, 10_000);
+
+    vi.advanceTimersByTime(500);
+
+    expect(await cache.get('short')).toBeUndefined();
+    expect(await cache.get('long')).toBe(2);
+  });
+
+  it('stores nothing for a zero TTL', async () => {
+    const cache = new MemoryCache<string>();
+    await cache.set('a', 'never', 0);
+
+    expect(await cache.get('a')).toBeUndefined();
+  });
+
+  it('starts over once full, but overwriting a key never evicts', async () => {
+    const cache = new MemoryCache<number>(2);
+    await cache.set('a', 1, 60_000);
+    await cache.set('b', 2, 60_000);
+    await cache.set('b', 3, 60_000);
+    expect(await cache.get('a')).toBe(1);
+
+    await cache.set('c', 4, 60_000);
+
+    expect(await cache.get('a')).toBeUndefined();
+    expect(await cache.get('c')).toBe(4);
+  });
+});
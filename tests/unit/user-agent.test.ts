@@ -0,0 +1,42 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+
+afterEach(() => {
+  vi.unstubAllEnvs();
+  vi.resetModules();
+});
+
+async function load() {
+  return import('../../functions/lib/user-agent');
+}
+
+describe('userAgent', () => {
+  it('defaults to the QRCheck resolver UA with the release version', async () => {
+    vi.stubEnv('USER_AGENT', '');
+    vi.stubEnv('QRCHECK_VERSION', '2.3.1');
+    const { userAgent } = await load();
+
+    expect(userAgent()).toBe('QRCheck-LinkResolver/2.3.1 (+https://qrcheck.ca)');
+  });
+
+  it('falls back to version 1.0 when no version is configured', async () => {
+    vi.stubEnv('QRCHECK_VERSION', '');
+    const { DEFAULT_USER_AGENT } = await load();
+
+    expect(DEFAULT_USER_AGENT).toBe('QRCheck-LinkResolver/1.0 (+https://qrcheck.ca)');
+  });
+
+  it('prefers USER_AGENT over any caller default', async () => {
+    vi.stubEnv('USER_AGENT', '  AcmeSecurity/4 ');
+    const { userAgent } = await load();
+
+    expect(userAgent()).toBe('AcmeSecurity/4');
+    expect(userAgent('Mozilla/5.0 QRCheck/Intel')).toBe('AcmeSecurity/4');
+  });
+
+  it('uses the caller default when USER_AGENT is unset', async () => {
+    vi.stubEnv('USER_AGENT', '');
+    const { userAgent } = await load();
+
+    expect(userAgent('Mozilla/5.0 QRCheck/Intel')).toBe('Mozilla/5.0 QRCheck/Intel');
+  });
+});
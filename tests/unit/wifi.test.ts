@@ -0,0 +1,55 @@
+import { describe, it, expect } from 'vitest';
+import { parseWifi } from '../../src/lib/wifi';
+import { parseQRContent } from '../../src/lib/decode';
+import { analyzePayload } from '../../src/lib/payload-analysis';
+
+describe('parseWifi', () => {
+  it('parses a WPA network', () => {
+    expect(parseWifi('WIFI:T:WPA;S:HomeNet;P:hunter2;;')).toEqual({
+      ssid: 'HomeNet',
+      authType: 'WPA',
+      password: 'hunter2',
+      hidden: false,
+      open: false
+    });
+  });
+
+  it('treats a missing or nopass type as an open network', () => {
+    expect(parseWifi('WIFI:S:Cafe Guest;;')).toMatchObject({ authType: 'NOPASS', open: true, password: undefined });
+    expect(parseWifi('WIFI:T:nopass;S:Cafe Guest;;')).toMatchObject({ authType: 'NOPASS', open: true });
+  });
+
+  it('reads the hidden flag and fields in any order', () => {
+    expect(parseWifi('WIFI:H:true;P:s3cret;S:Back Office;T:WPA2;;')).toEqual({
+      ssid: 'Back Office',
+      authType: 'WPA2',
+      password: 's3cret',
+      hidden: true,
+      open: false
+    });
+  });
+
+  it('unescapes special characters without trimming', () => {
+    expect(parseWifi('WIFI:T:WPA;S:Bob\\;s \\"Net\\";P: a\\:b\\\\c ;;')).toMatchObject({
+      ssid: 'Bob;s "Net"',
+      password: ' a:b\\c '
+    });
+  });
+});
+
+describe('wifi payload analysis', () => {
+  it('warns on open networks and notes hidden ones', () => {
+    const analysis = analyzePayload(parseQRContent('WIFI:T:nopass;S:Lobby;H:true;;'));
+
+    expect(analysis.checks.find(c => c.id === 'wifi-open')?.status).toBe('warn');
+    expect(analysis.checks.find(c => c.id === 'wifi-hidden')?.status).toBe('info');
+  });
+
+  it('never repeats the password in checks or recommendations', () => {
+    const content = parseQRContent('WIFI:T:WPA;S:HomeNet;P:correct-horse-battery;;');
+    const analysis = analyzePayload(content);
+
+    expect(content.wifi?.password).toBe('correct-horse-battery');
+    expect(JSON.stringify(analysis)).not.toContain('correct-horse-battery');
+  });
+});